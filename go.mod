@@ -7,6 +7,9 @@ require (
 	github.com/avast/retry-go v3.0.0+incompatible
 	github.com/go-micro/plugins/v4/transport/grpc v1.1.0
 	github.com/go-micro/plugins/v4/transport/nats v1.1.1-0.20220908125827-e0369dde429b
+	github.com/gorilla/websocket v1.5.0
+	github.com/nats-io/nats.go v1.17.0
+	github.com/pires/go-proxyproto v0.7.0
 	github.com/uptrace/bun v1.1.8
 	github.com/urfave/cli/v2 v2.16.3
 	go-micro.dev/v4 v4.8.1
@@ -60,7 +63,7 @@ require (
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
 	github.com/sergi/go-diff v1.2.0 // indirect
-	github.com/sirupsen/logrus v1.9.0 // indirect
+	github.com/sirupsen/logrus v1.9.0
 	github.com/tmthrgd/go-hex v0.0.0-20190904060850-447a3041c3bc // indirect
 	github.com/uptrace/bun/dialect/pgdialect v1.1.8 // indirect
 	github.com/vmihailenco/msgpack/v5 v5.3.5 // indirect
@@ -87,7 +90,6 @@ require (
 	github.com/google/uuid v1.3.0
 	github.com/kevinburke/ssh_config v1.2.0 // indirect
 	github.com/lib/pq v1.10.7 // indirect
-	github.com/nats-io/nats.go v1.17.0 // indirect
 	github.com/uptrace/bun/extra/bundebug v1.1.8 // indirect
 	go.uber.org/atomic v1.10.0 // indirect
 	golang.org/x/crypto v0.0.0-20220924013350-4ba4fb4dd9e7 // indirect
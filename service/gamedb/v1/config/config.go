@@ -6,4 +6,17 @@ var (
 
 const (
 	Name = "microlobby.gamedb.v1"
+
+	// TopicEvents is the broker topic which gets a GameEvent for each created, updated or deleted game
+	TopicEvents = "microlobby.gamedb.v1.events"
+
+	// Lifecycle events for bots, see docs/events.md
+	TopicGameCreated  = "microlobby.gamedb.v1.game.created"
+	TopicGameUpdated  = "microlobby.gamedb.v1.game.updated"
+	TopicGameDeleted  = "microlobby.gamedb.v1.game.deleted"
+	TopicPlayerJoined = "microlobby.gamedb.v1.player.joined"
+	TopicPlayerLeft   = "microlobby.gamedb.v1.player.left"
+
+	// EventSchemaVersion is in the meta of every lifecycle event
+	EventSchemaVersion = 1
 )
@@ -1,6 +1,8 @@
 package db
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/uptrace/bun"
 
@@ -16,6 +18,9 @@ type GamePlayer struct {
 	Name          string    `bun:"name" json:"name" yaml:"name"`
 	IpAddress     string    `bun:"ip_address" json:"ip_address" yaml:"ip_address"`
 	IsHost        bool      `bun:"is_host" json:"is_host" yaml:"is_host"`
+	Slot          *uint32   `bun:"slot" json:"slot" yaml:"slot"`
+	Team          uint32    `bun:"team" json:"team" yaml:"team"`
+	JoinID        *int      `bun:"join_id" json:"join_id" yaml:"join_id"`
 
 	sdb.Timestamps
 	sdb.SoftDelete
@@ -42,3 +47,29 @@ type Game struct {
 	sdb.Timestamps
 	sdb.SoftDelete
 }
+
+type GameJoin struct {
+	bun.BaseModel `bun:"game_joins,alias:j"`
+	Id            int          `bun:"id,pk,autoincrement,type:bigserial" json:"id" yaml:"id"`
+	GameID        uuid.UUID    `bun:"game_id,type:uuid" json:"game_id" yaml:"game_id"`
+	UserID        uuid.UUID    `bun:"user_id,type:uuid" json:"user_id" yaml:"user_id"`
+	SecretHash    string       `bun:"secret_hash" json:"-" yaml:"-"`
+	ExpiresAt     time.Time    `bun:"expires_at" json:"expires_at" yaml:"expires_at"`
+	KickedAt      bun.NullTime `bun:"kicked_at" json:"kicked_at" yaml:"kicked_at"`
+	ReportedAt    bun.NullTime `bun:"reported_at" json:"reported_at" yaml:"reported_at"`
+
+	sdb.Timestamps
+	sdb.SoftDelete
+}
+
+type GameKick struct {
+	bun.BaseModel `bun:"game_kicks,alias:k"`
+	Id            int       `bun:"id,pk,autoincrement,type:bigserial" json:"id" yaml:"id"`
+	GameID        uuid.UUID `bun:"game_id,type:uuid" json:"game_id" yaml:"game_id"`
+	JoinID        int       `bun:"join_id" json:"join_id" yaml:"join_id"`
+	HostUUID      uuid.UUID `bun:"host_uuid,type:uuid" json:"host_uuid" yaml:"host_uuid"`
+	PlayerUUID    uuid.UUID `bun:"player_uuid,type:uuid" json:"player_uuid" yaml:"player_uuid"`
+
+	sdb.Timestamps
+	sdb.SoftDelete
+}
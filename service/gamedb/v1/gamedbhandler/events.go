@@ -0,0 +1,125 @@
+package gamedbhandler
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"go-micro.dev/v4"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"jochum.dev/jo-micro/buncomponent"
+	"jochum.dev/jo-micro/logruscomponent"
+	"wz2100.net/microlobby/service/gamedb/v1/config"
+	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+)
+
+// changes is what a request did to a game, it gets published after the commit
+type changes struct {
+	action gamedbpb.GameEvent_Action
+	game   *gamedbpb.Game
+
+	changedFields []string
+	reason        gamedbpb.DeleteReason
+	joined        []*gamedbpb.Player
+	left          []*gamedbpb.Player
+}
+
+// changedFields returns the JSON names of the fields which differ between a and b
+func changedFields(a, b *gamedbpb.Game) []string {
+	result := []string{}
+
+	ra := a.ProtoReflect()
+	rb := b.ProtoReflect()
+	fields := ra.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+
+		// Compare messages with only this field set, that works for lists and scalars
+		fa := &gamedbpb.Game{}
+		if ra.Has(fd) {
+			fa.ProtoReflect().Set(fd, ra.Get(fd))
+		}
+		fb := &gamedbpb.Game{}
+		if rb.Has(fd) {
+			fb.ProtoReflect().Set(fd, rb.Get(fd))
+		}
+
+		if !proto.Equal(fa, fb) {
+			result = append(result, fd.JSONName())
+		}
+	}
+
+	return result
+}
+
+// playerKey identifies a player in a game, legacy lobby players have no uuid
+func playerKey(p *gamedbpb.Player) string {
+	if len(p.Uuid) > 0 && p.Uuid != uuid.Nil.String() {
+		return p.Uuid
+	}
+
+	return "name:" + p.Name
+}
+
+// diffPlayers returns the players which are new in b and the ones which are gone
+func diffPlayers(a, b []*gamedbpb.Player) (joined []*gamedbpb.Player, left []*gamedbpb.Player) {
+	inA := make(map[string]struct{}, len(a))
+	for _, p := range a {
+		inA[playerKey(p)] = struct{}{}
+	}
+	inB := make(map[string]struct{}, len(b))
+	for _, p := range b {
+		inB[playerKey(p)] = struct{}{}
+		if _, ok := inA[playerKey(p)]; !ok {
+			joined = append(joined, p)
+		}
+	}
+	for _, p := range a {
+		if _, ok := inB[playerKey(p)]; !ok {
+			left = append(left, p)
+		}
+	}
+
+	return joined, left
+}
+
+func (h *Handler) publish(ctx context.Context, topic string, msg interface{}) {
+	if err := micro.NewEvent(topic, h.cReg.Service().Client()).Publish(ctx, msg); err != nil {
+		logruscomponent.MustReg(h.cReg).Logger().WithField("topic", topic).Error(err)
+	}
+}
+
+// publishChanges tells the gateway and bots about a committed change, a failure doesn't fail the request
+func (h *Handler) publishChanges(ctx context.Context, c *changes) {
+	meta := &gamedbpb.EventMeta{SchemaVersion: config.EventSchemaVersion, Time: timestamppb.Now()}
+
+	// Without a sequence the event can't be resumed, but live subscribers still want it
+	err := buncomponent.MustReg(h.cReg).Bun().NewSelect().
+		ColumnExpr("nextval('game_event_seq')").
+		Scan(ctx, &meta.Sequence)
+	if err != nil {
+		logruscomponent.MustReg(h.cReg).Logger().Error(err)
+	}
+
+	feedGame := c.game
+	if c.action == gamedbpb.GameEvent_DELETED {
+		feedGame = &gamedbpb.Game{Id: c.game.Id}
+	}
+	h.publish(ctx, config.TopicEvents, &gamedbpb.GameEvent{Action: c.action, Game: feedGame, Sequence: meta.Sequence})
+
+	switch c.action {
+	case gamedbpb.GameEvent_CREATED:
+		h.publish(ctx, config.TopicGameCreated, &gamedbpb.GameCreated{Meta: meta, Game: c.game})
+	case gamedbpb.GameEvent_UPDATED:
+		h.publish(ctx, config.TopicGameUpdated, &gamedbpb.GameUpdated{Meta: meta, Game: c.game, ChangedFields: c.changedFields})
+	case gamedbpb.GameEvent_DELETED:
+		h.publish(ctx, config.TopicGameDeleted, &gamedbpb.GameDeleted{Meta: meta, Game: c.game, Reason: c.reason})
+	}
+
+	for _, p := range c.joined {
+		h.publish(ctx, config.TopicPlayerJoined, &gamedbpb.PlayerJoined{Meta: meta, GameId: c.game.Id, Player: p})
+	}
+	for _, p := range c.left {
+		h.publish(ctx, config.TopicPlayerLeft, &gamedbpb.PlayerLeft{Meta: meta, GameId: c.game.Id, Player: p})
+	}
+}
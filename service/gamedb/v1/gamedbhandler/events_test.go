@@ -0,0 +1,74 @@
+package gamedbhandler
+
+import (
+	"reflect"
+	"testing"
+
+	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+)
+
+func TestChangedFields(t *testing.T) {
+	base := func() *gamedbpb.Game {
+		return &gamedbpb.Game{
+			Description: "2v2",
+			Map:         "Sk-Rush",
+			Players:     []*gamedbpb.Player{{Uuid: hostId, Name: "host"}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(g *gamedbpb.Game)
+		want   []string
+	}{
+		{"unchanged", func(g *gamedbpb.Game) {}, []string{}},
+		{"scalar", func(g *gamedbpb.Game) { g.Description = "1v1" }, []string{"description"}},
+		{"cleared", func(g *gamedbpb.Game) { g.Map = "" }, []string{"map"}},
+		{"set", func(g *gamedbpb.Game) { g.IsPrivate = true }, []string{"isPrivate"}},
+		{"player renamed", func(g *gamedbpb.Game) { g.Players[0].Name = "other" }, []string{"players"}},
+		{"player added", func(g *gamedbpb.Game) { g.Players = append(g.Players, &gamedbpb.Player{Uuid: playerId}) }, []string{"players"}},
+		{"two", func(g *gamedbpb.Game) { g.Description = "1v1"; g.Players = nil }, []string{"description", "players"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := base()
+			tt.change(b)
+			if got := changedFields(base(), b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("changedFields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffPlayers(t *testing.T) {
+	host := &gamedbpb.Player{Uuid: hostId, Name: "host"}
+	player := &gamedbpb.Player{Uuid: playerId, Name: "player"}
+	legacy := &gamedbpb.Player{Name: "legacy"}
+	legacyNil := &gamedbpb.Player{Uuid: "00000000-0000-0000-0000-000000000000", Name: "legacy"}
+
+	tests := []struct {
+		name   string
+		a, b   []*gamedbpb.Player
+		joined []*gamedbpb.Player
+		left   []*gamedbpb.Player
+	}{
+		{"same", []*gamedbpb.Player{host, player}, []*gamedbpb.Player{player, host}, nil, nil},
+		{"joined", []*gamedbpb.Player{host}, []*gamedbpb.Player{host, player}, []*gamedbpb.Player{player}, nil},
+		{"left", []*gamedbpb.Player{host, player}, []*gamedbpb.Player{host}, nil, []*gamedbpb.Player{player}},
+		{"replaced", []*gamedbpb.Player{player}, []*gamedbpb.Player{host}, []*gamedbpb.Player{host}, []*gamedbpb.Player{player}},
+		{"legacy by name", []*gamedbpb.Player{legacy}, []*gamedbpb.Player{legacyNil}, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			joined, left := diffPlayers(tt.a, tt.b)
+			if !reflect.DeepEqual(joined, tt.joined) {
+				t.Errorf("joined = %v, want %v", joined, tt.joined)
+			}
+			if !reflect.DeepEqual(left, tt.left) {
+				t.Errorf("left = %v, want %v", left, tt.left)
+			}
+		})
+	}
+}
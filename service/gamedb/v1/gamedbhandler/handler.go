@@ -2,9 +2,13 @@ package gamedbhandler
 
 import (
 	"context"
+	"database/sql"
+	"net"
+	"time"
 
 	"github.com/golang/protobuf/ptypes/empty"
 	"github.com/google/uuid"
+	"github.com/uptrace/bun"
 	"github.com/urfave/cli/v2"
 	"go-micro.dev/v4/errors"
 	"go-micro.dev/v4/server"
@@ -13,7 +17,11 @@ import (
 	"jochum.dev/jo-micro/components"
 	"jochum.dev/jo-micro/router"
 	"wz2100.net/microlobby/service/gamedb/v1/db"
+	"wz2100.net/microlobby/shared/badwords"
+	"wz2100.net/microlobby/shared/motd"
 	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+	"wz2100.net/microlobby/shared/utils"
+	"wz2100.net/microlobby/shared/visibility"
 )
 
 func dbPlayerToProto(dp *db.GamePlayer) (*gamedbpb.Player, error) {
@@ -22,6 +30,8 @@ func dbPlayerToProto(dp *db.GamePlayer) (*gamedbpb.Player, error) {
 		Name:      dp.Name,
 		IpAddress: dp.IpAddress,
 		IsHost:    dp.IsHost,
+		Slot:      dp.Slot,
+		Team:      dp.Team,
 	}, nil
 }
 
@@ -61,6 +71,8 @@ func protoPlayerToDB(pp *gamedbpb.Player) (*db.GamePlayer, error) {
 			Name:      pp.Name,
 			IpAddress: pp.IpAddress,
 			IsHost:    pp.IsHost,
+			Slot:      pp.Slot,
+			Team:      pp.Team,
 		}, nil
 	}
 
@@ -73,6 +85,8 @@ func protoPlayerToDB(pp *gamedbpb.Player) (*db.GamePlayer, error) {
 		Name:      pp.Name,
 		IpAddress: pp.IpAddress,
 		IsHost:    pp.IsHost,
+		Slot:      pp.Slot,
+		Team:      pp.Team,
 	}, nil
 }
 
@@ -116,13 +130,27 @@ func protoGameToDB(pg *gamedbpb.Game, dg *db.Game) error {
 
 const Name = "gamedbHandler"
 
+// maxV3GameIdAttempts limits how often we skip ids still in use after the sequence wrapped
+const maxV3GameIdAttempts = 100
+
 type Handler struct {
 	cReg        *components.Registry
 	initialized bool
+
+	probeTimeout time.Duration
+	joinTTL      time.Duration
+
+	hooks hookCache
 }
 
 func New() *Handler {
-	return &Handler{initialized: false}
+	return &Handler{
+		initialized: false,
+		hooks: hookCache{
+			services: make(map[string][]string),
+			fetched:  make(map[string]time.Time),
+		},
+	}
 }
 
 func MustReg(cReg *components.Registry) *Handler {
@@ -147,6 +175,8 @@ func (h *Handler) Init(components *components.Registry, cli *cli.Context) error
 	}
 
 	h.cReg = components
+	h.probeTimeout = time.Duration(cli.Int("gamedb_probe_timeout")) * time.Second
+	h.joinTTL = time.Duration(cli.Int("gamedb_join_ttl")) * time.Second
 
 	r := router.MustReg(h.cReg)
 	r.Add(
@@ -163,6 +193,53 @@ func (h *Handler) Init(components *components.Registry, cli *cli.Context) error
 			router.Endpoint(gamedbpb.GameDBV1Service.Create),
 			router.AuthRequired(),
 		),
+		router.NewRoute(
+			router.Method(router.MethodGet),
+			router.Path("/motd"),
+			router.Endpoint(gamedbpb.GameDBV1Service.Motd),
+			router.Params("version", "locale"),
+		),
+		router.NewRoute(
+			router.Method(router.MethodGet),
+			router.Path("/:id"),
+			router.Endpoint(gamedbpb.GameDBV1Service.Get),
+			router.Params("id"),
+		),
+		router.NewRoute(
+			router.Method(router.MethodPost),
+			router.Path("/:id/join"),
+			router.Endpoint(gamedbpb.GameDBV1Service.Join),
+			router.Params("id"),
+			router.AuthRequired(),
+		),
+		router.NewRoute(
+			router.Method(router.MethodPost),
+			router.Path("/:id/player"),
+			router.Endpoint(gamedbpb.GameDBV1Service.AddPlayer),
+			router.Params("id"),
+			router.AuthRequired(),
+		),
+		router.NewRoute(
+			router.Method(router.MethodPost),
+			router.Path("/:id/kicked"),
+			router.Endpoint(gamedbpb.GameDBV1Service.Kicked),
+			router.Params("id"),
+			router.AuthRequired(),
+		),
+		router.NewRoute(
+			router.Method(router.MethodPut),
+			router.Path("/:id/player/:uuid"),
+			router.Endpoint(gamedbpb.GameDBV1Service.UpdatePlayer),
+			router.Params("id", "uuid"),
+			router.AuthRequired(),
+		),
+		router.NewRoute(
+			router.Method(router.MethodDelete),
+			router.Path("/:id/player/:uuid"),
+			router.Endpoint(gamedbpb.GameDBV1Service.RemovePlayer),
+			router.Params("id", "uuid", "slot"),
+			router.AuthRequired(),
+		),
 		router.NewRoute(
 			router.Method(router.MethodPut),
 			router.Path("/:id"),
@@ -190,7 +267,18 @@ func (h *Handler) Stop() error {
 }
 
 func (h *Handler) Flags(r *components.Registry) []cli.Flag {
-	return []cli.Flag{}
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:  "gamedb_probe_timeout",
+			Usage: "Time in seconds to wait for a new games host to accept a connection, 0 disables the probe",
+			Value: 5,
+		},
+		&cli.IntFlag{
+			Name:  "gamedb_join_ttl",
+			Usage: "Time in seconds a join secret is valid",
+			Value: 300,
+		},
+	}
 }
 
 func (h *Handler) Health(context context.Context) error {
@@ -213,7 +301,27 @@ func (h *Handler) List(ctx context.Context, in *gamedbpb.ListRequest, out *gamed
 		}
 	}
 
-	count, err := buncomponent.MustReg(h.cReg).Bun().NewSelect().Model((*db.Game)(nil)).Count(ctx)
+	// Private games are for their players, the same as visibility.Viewer.CanSee does for a single game
+	visible := func(q *bun.SelectQuery) *bun.SelectQuery {
+		if auth2.IntersectsRoles(user, auth2.RolesServiceAndAdmin...) {
+			return q
+		}
+
+		userId, err := uuid.Parse(user.Id)
+		if err != nil {
+			return q.Where("NOT g.is_private")
+		}
+
+		return q.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("NOT g.is_private").
+				WhereOr("EXISTS (SELECT 1 FROM game_players AS vp WHERE vp.game_id = g.id AND vp.uuid = ? AND vp.deleted_at IS NULL)", userId)
+		})
+	}
+
+	count, err := buncomponent.MustReg(h.cReg).Bun().NewSelect().
+		Model((*db.Game)(nil)).
+		Apply(visible).
+		Count(ctx)
 	if err != nil {
 		return errors.FromError(err)
 	}
@@ -223,6 +331,7 @@ func (h *Handler) List(ctx context.Context, in *gamedbpb.ListRequest, out *gamed
 		Model(&games).
 		Relation("Players").
 		ColumnExpr("g.*").
+		Apply(visible).
 		Limit(int(in.Limit)).
 		Offset(int(in.Offset)).
 		Scan(ctx)
@@ -239,12 +348,63 @@ func (h *Handler) List(ctx context.Context, in *gamedbpb.ListRequest, out *gamed
 			return errors.FromError(err)
 		}
 
+		// HostIp and the players IP's are for the players of that game
+		v := visibility.ViewerOf(user, pg)
+		if !v.CanSee(pg) {
+			continue
+		}
+		v.Redact(user.Id, pg)
+
 		out.Games = append(out.Games, pg)
 	}
 
 	return nil
 }
 
+func (h *Handler) Get(ctx context.Context, in *gamedbpb.GetRequest, out *gamedbpb.Game) error {
+	// Anonymous callers have no user
+	user, err := auth2.ClientAuthMustReg(h.cReg).Plugin().Inspect(ctx)
+	if err != nil {
+		user = nil
+	}
+
+	gameId, err := uuid.Parse(in.Id)
+	if err != nil {
+		return errors.NotFound("GAME_NOT_FOUND", "Game '%s' not found", in.Id)
+	}
+
+	// Soft deleted games and players don't get selected
+	var dg db.Game
+	err = buncomponent.MustReg(h.cReg).Bun().NewSelect().
+		Model(&dg).
+		Relation("Players").
+		Limit(1).
+		Where("g.id = ?", gameId).Scan(ctx)
+	if err == sql.ErrNoRows {
+		return errors.NotFound("GAME_NOT_FOUND", "Game '%s' not found", in.Id)
+	} else if err != nil {
+		return errors.FromError(err)
+	}
+
+	if err := dbGameToProto(&dg, out); err != nil {
+		return errors.FromError(err)
+	}
+
+	v := visibility.ViewerOf(user, out)
+	if !v.CanSee(out) {
+		// Same as missing, don't tell that it exists
+		return errors.NotFound("GAME_NOT_FOUND", "Game '%s' not found", in.Id)
+	}
+
+	userId := ""
+	if user != nil {
+		userId = user.Id
+	}
+	v.Redact(userId, out)
+
+	return nil
+}
+
 func (h *Handler) checkGame(ctx context.Context, dg *db.Game, oldG *db.Game) error {
 	user, err := auth2.ClientAuthMustReg(h.cReg).Plugin().Inspect(ctx)
 	if err != nil {
@@ -272,8 +432,38 @@ func (h *Handler) checkGame(ctx context.Context, dg *db.Game, oldG *db.Game) err
 		return errors.BadRequest("NO_MATCH", "No host player given or IP's don't match")
 	}
 
-	if !auth2.IntersectsRoles(user, auth2.RolesServiceAndAdmin...) && nHostPlayer.UUID.String() != user.Id {
-		return errors.BadRequest("NOT_ALLOWED", "Your only allowed to host own games")
+	slots := make(map[uint32]struct{}, len(dg.Players))
+	for _, dp := range dg.Players {
+		if dp.Slot == nil {
+			continue
+		}
+
+		if *dp.Slot >= dg.MaxPlayers {
+			return errors.BadRequest("INVALID_SLOT", "Slot %d is out of range", *dp.Slot)
+		}
+		if _, ok := slots[*dp.Slot]; ok {
+			return errors.BadRequest("SLOT_TAKEN", "Slot %d is taken", *dp.Slot)
+		}
+		slots[*dp.Slot] = struct{}{}
+	}
+
+	if !auth2.IntersectsRoles(user, auth2.RolesServiceAndAdmin...) {
+		if nHostPlayer.UUID.String() != user.Id {
+			return errors.BadRequest("NOT_ALLOWED", "Your only allowed to host own games")
+		}
+
+		// Other players join with a secret, see AddPlayer
+		known := map[uuid.UUID]struct{}{nHostPlayer.UUID: {}}
+		if oldG != nil {
+			for _, dp := range oldG.Players {
+				known[dp.UUID] = struct{}{}
+			}
+		}
+		for _, dp := range dg.Players {
+			if _, ok := known[dp.UUID]; !ok {
+				return errors.BadRequest("NOT_ALLOWED", "Players have to join with a secret")
+			}
+		}
 	}
 
 	// Update?
@@ -302,6 +492,43 @@ func (h *Handler) checkGame(ctx context.Context, dg *db.Game, oldG *db.Game) err
 	return nil
 }
 
+// filterFields runs user supplied texts through the badwords policy, errId is the id of the error for profane texts
+func (h *Handler) filterFields(ctx context.Context, errId string, fields ...badwords.Field) error {
+	// Users can't read the policy nor call the badwords service
+	sCtx, err := auth2.ClientAuthMustReg(h.cReg).Plugin().ServiceContext(ctx)
+	if err != nil {
+		return errors.FromError(err)
+	}
+
+	policy, err := badwords.LoadPolicy(sCtx, h.cReg)
+	if err != nil {
+		return err
+	}
+
+	if err := policy.Apply(sCtx, h.cReg, fields...); err != nil {
+		if perr, ok := err.(*badwords.ProfaneError); ok {
+			return errors.BadRequest(errId, "The %s contains words which are not allowed", perr.Field)
+		}
+
+		return errors.FromError(err)
+	}
+
+	return nil
+}
+
+// filterGame runs the user supplied texts of dg through the badwords policy
+func (h *Handler) filterGame(ctx context.Context, dg *db.Game) error {
+	fields := []badwords.Field{
+		{Name: "description", Value: &dg.Description},
+		{Name: "map", Value: &dg.Map},
+	}
+	for _, dp := range dg.Players {
+		fields = append(fields, badwords.Field{Name: "player name", Value: &dp.Name})
+	}
+
+	return h.filterFields(ctx, "PROFANE_GAME", fields...)
+}
+
 func (h *Handler) Create(ctx context.Context, in *gamedbpb.Game, out *gamedbpb.Game) error {
 	dg := &db.Game{}
 	err := protoGameToDB(in, dg)
@@ -313,28 +540,63 @@ func (h *Handler) Create(ctx context.Context, in *gamedbpb.Game, out *gamedbpb.G
 		return err
 	}
 
-	_, err = buncomponent.MustReg(h.cReg).Bun().NewInsert().
-		Model(dg).
-		Exec(ctx)
-	if err != nil {
+	if err := h.filterGame(ctx, dg); err != nil {
+		return err
+	}
+
+	// The legacy lobby probed the address of its client already
+	if h.probeTimeout > 0 && dg.LobbyVersion != 3 {
+		// Users choose the address, don't connect into our own networks
+		ip := net.ParseIP(dg.HostIp)
+		if ip == nil || !utils.IsPublicIP(ip) {
+			return errors.BadRequest("INVALID_HOST_IP", "The host IP must be a public address")
+		}
+
+		if err := utils.ProbeHost(ctx, ip.String(), dg.Port, h.probeTimeout); err != nil {
+			return errors.BadRequest("FAILED_VERIFY_HOST_CONNECTION", "Unable to connect to host. A firewall may be blocking access")
+		}
+	}
+
+	pg := &gamedbpb.Game{}
+	if err := dbGameToProto(dg, pg); err != nil {
 		return errors.FromError(err)
 	}
+	if err := h.preCreate(ctx, pg); err != nil {
+		return err
+	}
 
-	for _, dp := range dg.Players {
-		dp.GameID = dg.Id
-		_, err = buncomponent.MustReg(h.cReg).Bun().NewInsert().
-			Model(dp).
-			Exec(ctx)
+	if dg.LobbyVersion == 3 && dg.V3GameId == 0 {
+		dg.V3GameId, err = h.nextV3GameId(ctx)
 		if err != nil {
-			return errors.FromError(err)
+			return err
 		}
 	}
 
+	err = buncomponent.MustReg(h.cReg).Bun().RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(dg).Exec(ctx); err != nil {
+			return err
+		}
+
+		for _, dp := range dg.Players {
+			dp.GameID = dg.Id
+			if _, err := tx.NewInsert().Model(dp).Exec(ctx); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return errors.FromError(err)
+	}
+
 	err = dbGameToProto(dg, out)
 	if err != nil {
 		return errors.FromError(err)
 	}
 
+	// The initial players are part of GameCreated, they don't join
+	h.publishChanges(ctx, &changes{action: gamedbpb.GameEvent_CREATED, game: out})
 	return nil
 }
 
@@ -359,17 +621,84 @@ func (h *Handler) Update(ctx context.Context, in *gamedbpb.Game, out *gamedbpb.G
 		return err
 	}
 
-	// Finaly update
-	_, err = buncomponent.MustReg(h.cReg).Bun().NewUpdate().Model(dg).Exec(ctx)
+	user, err := auth2.ClientAuthMustReg(h.cReg).Plugin().Inspect(ctx)
 	if err != nil {
 		return errors.FromError(err)
 	}
+	if !auth2.IntersectsRoles(user, auth2.RolesServiceAndAdmin...) {
+		keepPlayerFields(user, dg, &result)
+	}
+
+	if err := h.filterGame(ctx, dg); err != nil {
+		return err
+	}
+
+	oldPg := &gamedbpb.Game{}
+	if err := dbGameToProto(&result, oldPg); err != nil {
+		return errors.FromError(err)
+	}
 
 	err = dbGameToProto(dg, out)
 	if err != nil {
 		return errors.FromError(err)
 	}
+	joined, left := diffPlayers(oldPg.Players, out.Players)
 
+	if err := h.preUpdate(ctx, out); err != nil {
+		return err
+	}
+
+	// Finaly update, the game and its players in one go
+	now := bun.NullTime{Time: time.Now()}
+	dg.UpdatedAt = now
+	err = buncomponent.MustReg(h.cReg).Bun().RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewUpdate().Model(dg).ExcludeColumn("id", "created_at", "deleted_at").WherePK().Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		oldPlayers := make(map[string]*db.GamePlayer, len(result.Players))
+		for i, dp := range result.Players {
+			oldPlayers[playerKey(oldPg.Players[i])] = dp
+		}
+
+		for i, dp := range dg.Players {
+			dp.GameID = dg.Id
+			dp.UpdatedAt = now
+
+			if oldDp, ok := oldPlayers[playerKey(out.Players[i])]; ok {
+				dp.Id = oldDp.Id
+				_, err := tx.NewUpdate().Model(dp).Column("name", "ip_address", "is_host", "slot", "team", "updated_at").WherePK().Exec(ctx)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			if _, err := tx.NewInsert().Model(dp).Exec(ctx); err != nil {
+				return err
+			}
+		}
+
+		for _, p := range left {
+			if err := leave(ctx, tx, oldPlayers[playerKey(p)]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return errors.FromError(err)
+	}
+
+	h.publishChanges(ctx, &changes{
+		action:        gamedbpb.GameEvent_UPDATED,
+		game:          out,
+		changedFields: changedFields(oldPg, out),
+		joined:        joined,
+		left:          left,
+	})
 	return nil
 }
 
@@ -378,24 +707,35 @@ func (h *Handler) Delete(ctx context.Context, in *gamedbpb.DeleteRequest, out *e
 	if err != nil {
 		return errors.FromError(err)
 	}
-	if !auth2.IntersectsRoles(user, auth2.RolesServiceAndAdmin...) {
-		var dg db.Game
-		err = buncomponent.MustReg(h.cReg).Bun().NewSelect().
-			Model(&dg).
-			Relation("Players").
-			Limit(1).
-			Where("g.id = ?", in.Id).Scan(ctx)
-		if err != nil {
-			return errors.FromError(err)
-		}
+	privileged := auth2.IntersectsRoles(user, auth2.RolesServiceAndAdmin...)
 
-		var nHostPlayer *db.GamePlayer
-		for _, dp := range dg.Players {
-			if dp.IsHost && dp.IpAddress == dg.HostIp {
-				nHostPlayer = dp
-				break
-			}
+	gameId, err := uuid.Parse(in.Id)
+	if err != nil {
+		return errors.NotFound("GAME_NOT_FOUND", "Game '%s' not found", in.Id)
+	}
+
+	// Nobody deletes a game twice, that would publish a second GameDeleted
+	var dg db.Game
+	err = buncomponent.MustReg(h.cReg).Bun().NewSelect().
+		Model(&dg).
+		Relation("Players").
+		Limit(1).
+		Where("g.id = ?", gameId).Scan(ctx)
+	if err == sql.ErrNoRows {
+		return errors.NotFound("GAME_NOT_FOUND", "Game '%s' not found", in.Id)
+	} else if err != nil {
+		return errors.FromError(err)
+	}
+
+	var nHostPlayer *db.GamePlayer
+	for _, dp := range dg.Players {
+		if dp.IsHost && dp.IpAddress == dg.HostIp {
+			nHostPlayer = dp
+			break
 		}
+	}
+
+	if !privileged {
 		if nHostPlayer == nil {
 			return errors.BadRequest("NO_MATCH", "No host player given or IP's don't match")
 		}
@@ -405,11 +745,94 @@ func (h *Handler) Delete(ctx context.Context, in *gamedbpb.DeleteRequest, out *e
 		}
 	}
 
+	// Services tell why, for everyone else it's the host or an admin
+	reason := gamedbpb.DeleteReason_DELETE_REASON_CLOSED
+	if auth2.IntersectsRoles(user, auth2.ROLE_SERVICE) && in.Reason != gamedbpb.DeleteReason_DELETE_REASON_UNKNOWN {
+		reason = in.Reason
+	} else if privileged && (nHostPlayer == nil || nHostPlayer.UUID.String() != user.Id) {
+		reason = gamedbpb.DeleteReason_DELETE_REASON_ADMIN
+	}
+
+	pg := &gamedbpb.Game{}
+	if err := dbGameToProto(&dg, pg); err != nil {
+		return errors.FromError(err)
+	}
+
+	// The lobby reports that the host is gone, there's nothing left a hook could keep
+	if reason != gamedbpb.DeleteReason_DELETE_REASON_DISCONNECTED && reason != gamedbpb.DeleteReason_DELETE_REASON_REPLACED {
+		if err := h.preDelete(ctx, &gamedbpb.DeleteRequest{Id: in.Id, Reason: reason}); err != nil {
+			return err
+		}
+	}
+
 	// Execute the Delete
-	_, err = buncomponent.MustReg(h.cReg).Bun().NewDelete().Model((*db.Game)(nil)).Where("g.id = ?", in.Id).Exec(ctx)
+	res, err := buncomponent.MustReg(h.cReg).Bun().NewDelete().Model((*db.Game)(nil)).Where("g.id = ?", gameId).Exec(ctx)
 	if err != nil {
 		return errors.FromError(err)
 	}
 
+	// A concurrent delete was faster, it published the event
+	if n, err := res.RowsAffected(); err != nil {
+		return errors.FromError(err)
+	} else if n < 1 {
+		return errors.NotFound("GAME_NOT_FOUND", "Game '%s' not found", in.Id)
+	}
+
+	h.publishChanges(ctx, &changes{action: gamedbpb.GameEvent_DELETED, game: pg, reason: reason})
+	return nil
+}
+
+// nextV3GameId allocates a lobby v3 game id from the database sequence, the sequence
+// is shared by all lobby_v3 replicas and cycles after MaxUint32, so skip ids still in use.
+func (h *Handler) nextV3GameId(ctx context.Context) (uint32, error) {
+	for i := 0; i < maxV3GameIdAttempts; i++ {
+		var id int64
+		err := buncomponent.MustReg(h.cReg).Bun().NewSelect().
+			ColumnExpr("nextval('v3_game_id_seq')").
+			Scan(ctx, &id)
+		if err != nil {
+			return 0, errors.FromError(err)
+		}
+
+		exists, err := buncomponent.MustReg(h.cReg).Bun().NewSelect().
+			Model((*db.Game)(nil)).
+			Where("g.v3_game_id = ?", id).
+			Exists(ctx)
+		if err != nil {
+			return 0, errors.FromError(err)
+		}
+
+		if !exists {
+			return uint32(id), nil
+		}
+	}
+
+	return 0, errors.InternalServerError("NO_V3_GAME_ID", "Failed to allocate a V3GameID")
+}
+
+func (h *Handler) NextV3GameId(ctx context.Context, in *empty.Empty, out *gamedbpb.V3GameIdResponse) error {
+	id, err := h.nextV3GameId(ctx)
+	if err != nil {
+		return err
+	}
+
+	out.V3GameId = id
+	return nil
+}
+
+func (h *Handler) Motd(ctx context.Context, in *gamedbpb.MotdRequest, out *gamedbpb.MotdResponse) error {
+	// Anonymous clients can't read the setting themself
+	sCtx, err := auth2.ClientAuthMustReg(h.cReg).Plugin().ServiceContext(ctx)
+	if err != nil {
+		return errors.FromError(err)
+	}
+
+	m, err := motd.Load(sCtx, h.cReg)
+	if err != nil {
+		return err
+	}
+
+	out.Text = m.Text(in.Version, in.Locale, time.Now())
+	out.Maintenance = m.Maintenance
 	return nil
 }
@@ -0,0 +1,202 @@
+package gamedbhandler
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go-micro.dev/v4/client"
+	"go-micro.dev/v4/errors"
+	"jochum.dev/jo-micro/auth2"
+	"jochum.dev/jo-micro/logruscomponent"
+	"wz2100.net/microlobby/service/settings"
+	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+	"wz2100.net/microlobby/shared/serviceregistry"
+)
+
+const (
+	// hooksName is the name of the setting which holds the HooksConfig
+	hooksName = "hooks"
+
+	// hooksCacheTTL is how long we remember which services have hooks, listing the registry is expensive
+	hooksCacheTTL = 10 * time.Second
+)
+
+// Endpoints of the pre hooks
+const (
+	hookCreate = "GameDBV1PreService.Create"
+	hookUpdate = "GameDBV1PreService.Update"
+	hookDelete = "GameDBV1PreService.Delete"
+)
+
+type HookService struct {
+	// Timeout in seconds, 0 uses the default
+	Timeout int `json:"timeout"`
+	// Disabled hooks don't get called
+	Disabled bool `json:"disabled"`
+	// Optional hooks which time out or can't be reached get skipped, their errors still veto
+	Optional bool `json:"optional"`
+}
+
+type HooksConfig struct {
+	// Timeout is the default time in seconds a hook has to answer
+	Timeout int `json:"timeout"`
+	// Order are service names, their hooks run first in this order, the others after them by name
+	Order []string `json:"order"`
+	// Services configures single services by name
+	Services map[string]HookService `json:"services"`
+}
+
+func defaultHooksConfig() HooksConfig {
+	return HooksConfig{
+		Timeout:  2,
+		Order:    []string{},
+		Services: map[string]HookService{},
+	}
+}
+
+// sort orders services like the config says
+func (c *HooksConfig) sort(services []string) {
+	rank := make(map[string]int, len(c.Order))
+	for i, name := range c.Order {
+		rank[name] = i
+	}
+
+	sort.SliceStable(services, func(i, j int) bool {
+		ri, iOk := rank[services[i]]
+		rj, jOk := rank[services[j]]
+		switch {
+		case iOk && jOk:
+			return ri < rj
+		case iOk != jOk:
+			return iOk
+		}
+		return services[i] < services[j]
+	})
+}
+
+// hookCache remembers the services per hook endpoint
+type hookCache struct {
+	lock     sync.Mutex
+	services map[string][]string
+	fetched  map[string]time.Time
+}
+
+func (h *Handler) loadHooksConfig(ctx context.Context) (HooksConfig, error) {
+	c := defaultHooksConfig()
+	err := settings.MustReg(h.cReg).LoadJSON(ctx, h.cReg.Service().Name(), hooksName, &c)
+	return c, err
+}
+
+// hookServices returns the names of the services with the endpoint, each once
+func (h *Handler) hookServices(ctx context.Context, endpoint string) ([]string, error) {
+	h.hooks.lock.Lock()
+	defer h.hooks.lock.Unlock()
+
+	if time.Since(h.hooks.fetched[endpoint]) < hooksCacheTTL {
+		return h.hooks.services[endpoint], nil
+	}
+
+	services, err := serviceregistry.FindByEndpoint(ctx, h.cReg, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	// The registry lists a service per version
+	seen := make(map[string]struct{}, len(services))
+	names := []string{}
+	for _, s := range services {
+		if _, ok := seen[s.Name]; ok {
+			continue
+		}
+		seen[s.Name] = struct{}{}
+		names = append(names, s.Name)
+	}
+
+	h.hooks.services[endpoint] = names
+	h.hooks.fetched[endpoint] = time.Now()
+	return names, nil
+}
+
+// runHooks calls the endpoint on all services which have it, the first error vetoes
+func (h *Handler) runHooks(ctx context.Context, endpoint string, call func(ctx context.Context, pre gamedbpb.GameDBV1PreService, opts ...client.CallOption) error) error {
+	// Hooks are service to service
+	sCtx, err := auth2.ClientAuthMustReg(h.cReg).Plugin().ServiceContext(ctx)
+	if err != nil {
+		return errors.FromError(err)
+	}
+
+	services, err := h.hookServices(sCtx, endpoint)
+	if err != nil {
+		return errors.FromError(err)
+	}
+	if len(services) == 0 {
+		return nil
+	}
+
+	c, err := h.loadHooksConfig(sCtx)
+	if err != nil {
+		return err
+	}
+	services = append([]string{}, services...)
+	c.sort(services)
+
+	logger := logruscomponent.MustReg(h.cReg).Logger().WithField("hook", endpoint)
+	for _, name := range services {
+		sc := c.Services[name]
+		if sc.Disabled {
+			continue
+		}
+
+		timeout := c.Timeout
+		if sc.Timeout > 0 {
+			timeout = sc.Timeout
+		}
+		d := time.Duration(timeout) * time.Second
+
+		hCtx, cancel := context.WithTimeout(sCtx, d)
+		err := call(hCtx, gamedbpb.NewGameDBV1PreService(name, h.cReg.Service().Client()), client.WithRequestTimeout(d))
+		cancel()
+		if err == nil {
+			continue
+		}
+
+		// Errors of the client are timeouts and unreachable services, not a veto of the hook
+		mErr := errors.FromError(err)
+		if mErr.Id == "go.micro.client" {
+			if sc.Optional {
+				logger.WithField("service", name).Warn("Skipping the optional hook: ", err)
+				continue
+			}
+
+			logger.WithField("service", name).Error(err)
+			return errors.InternalServerError("HOOK_FAILED", "The hook of %s failed", name)
+		}
+
+		return mErr
+	}
+
+	return nil
+}
+
+func (h *Handler) preCreate(ctx context.Context, g *gamedbpb.Game) error {
+	return h.runHooks(ctx, hookCreate, func(ctx context.Context, pre gamedbpb.GameDBV1PreService, opts ...client.CallOption) error {
+		_, err := pre.Create(ctx, g, opts...)
+		return err
+	})
+}
+
+func (h *Handler) preUpdate(ctx context.Context, g *gamedbpb.Game) error {
+	return h.runHooks(ctx, hookUpdate, func(ctx context.Context, pre gamedbpb.GameDBV1PreService, opts ...client.CallOption) error {
+		_, err := pre.Update(ctx, g, opts...)
+		return err
+	})
+}
+
+func (h *Handler) preDelete(ctx context.Context, in *gamedbpb.DeleteRequest) error {
+	return h.runHooks(ctx, hookDelete, func(ctx context.Context, pre gamedbpb.GameDBV1PreService, opts ...client.CallOption) error {
+		_, err := pre.Delete(ctx, in, opts...)
+		return err
+	})
+}
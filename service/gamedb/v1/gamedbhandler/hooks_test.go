@@ -0,0 +1,34 @@
+package gamedbhandler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHooksConfigSort(t *testing.T) {
+	tests := []struct {
+		name     string
+		order    []string
+		services []string
+		want     []string
+	}{
+		{"by name", nil, []string{"c", "a", "b"}, []string{"a", "b", "c"}},
+		{"ordered first", []string{"c"}, []string{"a", "b", "c"}, []string{"c", "a", "b"}},
+		{"order kept", []string{"b", "c", "a"}, []string{"a", "b", "c"}, []string{"b", "c", "a"}},
+		{"unknown in order", []string{"x", "b"}, []string{"c", "b", "a"}, []string{"b", "a", "c"}},
+		{"empty", []string{"a"}, []string{}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := defaultHooksConfig()
+			c.Order = tt.order
+
+			services := append([]string{}, tt.services...)
+			c.sort(services)
+			if !reflect.DeepEqual(services, tt.want) {
+				t.Errorf("sort(%v) = %v, want %v", tt.services, services, tt.want)
+			}
+		})
+	}
+}
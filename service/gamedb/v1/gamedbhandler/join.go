@@ -0,0 +1,149 @@
+package gamedbhandler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+	"go-micro.dev/v4/errors"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"jochum.dev/jo-micro/auth2"
+	"jochum.dev/jo-micro/buncomponent"
+	"wz2100.net/microlobby/service/gamedb/v1/db"
+	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+)
+
+const (
+	// Joins per user, like the spec says
+	joinsPerMinute = 5
+	joinsPerHour   = 60
+
+	joinSecretBytes = 32
+)
+
+func newJoinSecret() (string, error) {
+	b := make([]byte, joinSecretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashSecret is what we store, a leaked database doesn't leak valid secrets
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// joinRateLimited reports whether userId joined too often
+func (h *Handler) joinRateLimited(ctx context.Context, userId uuid.UUID) (bool, error) {
+	limits := []struct {
+		window time.Duration
+		max    int
+	}{
+		{time.Minute, joinsPerMinute},
+		{time.Hour, joinsPerHour},
+	}
+
+	for _, l := range limits {
+		count, err := buncomponent.MustReg(h.cReg).Bun().NewSelect().
+			Model((*db.GameJoin)(nil)).
+			WhereAllWithDeleted().
+			Where("j.user_id = ?", userId).
+			Where("j.created_at > ?", time.Now().Add(-l.window)).
+			Count(ctx)
+		if err != nil {
+			return false, err
+		}
+
+		if count >= l.max {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (h *Handler) Join(ctx context.Context, in *gamedbpb.JoinRequest, out *gamedbpb.JoinResponse) error {
+	user, err := auth2.ClientAuthMustReg(h.cReg).Plugin().Inspect(ctx)
+	if err != nil {
+		return errors.FromError(err)
+	}
+
+	userId, err := uuid.Parse(user.Id)
+	if err != nil {
+		return errors.BadRequest("NOT_ALLOWED", "Only users can join games")
+	}
+
+	gameId, err := uuid.Parse(in.Id)
+	if err != nil {
+		return errors.NotFound("GAME_NOT_FOUND", "Game '%s' not found", in.Id)
+	}
+
+	var dg db.Game
+	err = buncomponent.MustReg(h.cReg).Bun().NewSelect().
+		Model(&dg).
+		Relation("Players").
+		Limit(1).
+		Where("g.id = ?", gameId).Scan(ctx)
+	if err == sql.ErrNoRows {
+		return errors.NotFound("GAME_NOT_FOUND", "Game '%s' not found", in.Id)
+	} else if err != nil {
+		return errors.FromError(err)
+	}
+
+	for _, dp := range dg.Players {
+		if dp.UUID != userId {
+			continue
+		}
+
+		if dp.IsHost {
+			return errors.BadRequest("NOT_ALLOWED", "You can't join your own game")
+		}
+		return errors.BadRequest("ALREADY_JOINED", "You are in that game already")
+	}
+
+	// Private games are invite only, outsiders don't learn that they exist
+	if dg.IsPrivate {
+		return errors.NotFound("GAME_NOT_FOUND", "Game '%s' not found", in.Id)
+	}
+
+	if uint32(len(dg.Players)) >= dg.MaxPlayers {
+		return errors.BadRequest("GAME_FULL", "The game is full")
+	}
+
+	limited, err := h.joinRateLimited(ctx, userId)
+	if err != nil {
+		return errors.FromError(err)
+	}
+	if limited {
+		return errors.New("TO_MANY_REQUESTS", "To many requests", 429)
+	}
+
+	secret, err := newJoinSecret()
+	if err != nil {
+		return errors.FromError(err)
+	}
+
+	join := &db.GameJoin{
+		GameID:     dg.Id,
+		UserID:     userId,
+		SecretHash: hashSecret(secret),
+		ExpiresAt:  time.Now().Add(h.joinTTL),
+	}
+	if _, err := buncomponent.MustReg(h.cReg).Bun().NewInsert().Model(join).Exec(ctx); err != nil {
+		return errors.FromError(err)
+	}
+
+	out.Ips = []*gamedbpb.HostAddress{{Ip: dg.HostIp, Port: dg.Port}}
+	out.Secret = secret
+	out.ExpiresAt = timestamppb.New(join.ExpiresAt)
+
+	return nil
+}
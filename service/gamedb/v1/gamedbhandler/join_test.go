@@ -0,0 +1,42 @@
+package gamedbhandler
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestHashSecret(t *testing.T) {
+	tests := []struct {
+		secret string
+		want   string
+	}{
+		{"", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{"abc", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+	}
+
+	for _, tt := range tests {
+		if got := hashSecret(tt.secret); got != tt.want {
+			t.Errorf("hashSecret(%q) = %s, want %s", tt.secret, got, tt.want)
+		}
+	}
+}
+
+func TestNewJoinSecret(t *testing.T) {
+	seen := make(map[string]struct{})
+	for i := 0; i < 100; i++ {
+		secret, err := newJoinSecret()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		raw, err := base64.RawURLEncoding.DecodeString(secret)
+		if err != nil || len(raw) != joinSecretBytes {
+			t.Fatalf("secret %q isn't %d bytes of URL safe base64: %v", secret, joinSecretBytes, err)
+		}
+
+		if _, ok := seen[secret]; ok {
+			t.Fatalf("secret %q came twice", secret)
+		}
+		seen[secret] = struct{}{}
+	}
+}
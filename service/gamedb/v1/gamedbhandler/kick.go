@@ -0,0 +1,120 @@
+package gamedbhandler
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"go-micro.dev/v4/errors"
+	"jochum.dev/jo-micro/auth2"
+	"jochum.dev/jo-micro/buncomponent"
+	"wz2100.net/microlobby/service/gamedb/v1/db"
+	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+)
+
+var (
+	errNotInThatGame   = errors.BadRequest("NOT_IN_THAT_GAME", "Your not in that game")
+	errAlreadyReported = errors.BadRequest("ALREADY_REPORTED", "You reported that kick already")
+)
+
+func (h *Handler) Kicked(ctx context.Context, in *gamedbpb.KickedRequest, out *empty.Empty) error {
+	user, err := auth2.ClientAuthMustReg(h.cReg).Plugin().Inspect(ctx)
+	if err != nil {
+		return errors.FromError(err)
+	}
+
+	playerId, err := uuid.Parse(user.Id)
+	if err != nil {
+		return errNotInThatGame
+	}
+
+	gameId, err := uuid.Parse(in.Id)
+	if err != nil {
+		return errors.NotFound("GAME_NOT_FOUND", "Game '%s' not found", in.Id)
+	}
+
+	// Kicks get reported after the game started, the lobby deleted it by then
+	var dg db.Game
+	err = buncomponent.MustReg(h.cReg).Bun().NewSelect().
+		Model(&dg).
+		WhereAllWithDeleted().
+		Relation("Players", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.WhereAllWithDeleted()
+		}).
+		Limit(1).
+		Where("g.id = ?", gameId).Scan(ctx)
+	if err == sql.ErrNoRows {
+		return errors.NotFound("GAME_NOT_FOUND", "Game '%s' not found", in.Id)
+	} else if err != nil {
+		return errors.FromError(err)
+	}
+
+	// The host added the player with this secret, AddPlayer used the join up
+	var join db.GameJoin
+	err = buncomponent.MustReg(h.cReg).Bun().NewSelect().
+		Model(&join).
+		WhereAllWithDeleted().
+		Where("j.secret_hash = ?", hashSecret(in.Secret)).
+		Where("j.game_id = ?", gameId).
+		Where("j.user_id = ?", playerId).
+		Where("j.deleted_at IS NOT NULL").
+		Limit(1).
+		Scan(ctx)
+	if err == sql.ErrNoRows {
+		return errNotInThatGame
+	} else if err != nil {
+		return errors.FromError(err)
+	}
+
+	// Only the host removing the player of that join is a kick, see RemovePlayer
+	host := hostOf(&dg)
+	dp := findPlayer(&dg, playerId)
+	if dp == nil || dp.JoinID == nil || *dp.JoinID != join.Id || host == nil || host.UUID == playerId {
+		return errNotInThatGame
+	}
+	if join.KickedAt.IsZero() {
+		return errNotInThatGame
+	}
+	if !join.ReportedAt.IsZero() {
+		return errAlreadyReported
+	}
+
+	err = buncomponent.MustReg(h.cReg).Bun().RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// A secret reports once, a concurrent report may have been faster
+		res, err := tx.NewUpdate().
+			Model((*db.GameJoin)(nil)).
+			Set("reported_at = ?", time.Now()).
+			WhereAllWithDeleted().
+			Where("j.id = ?", join.Id).
+			Where("j.reported_at IS NULL").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n < 1 {
+			return errAlreadyReported
+		}
+
+		_, err = tx.NewInsert().
+			Model(&db.GameKick{
+				GameID:     gameId,
+				JoinID:     join.Id,
+				HostUUID:   host.UUID,
+				PlayerUUID: playerId,
+			}).
+			Exec(ctx)
+		return err
+	})
+	if err == errAlreadyReported {
+		return err
+	} else if err != nil {
+		return errors.FromError(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,474 @@
+package gamedbhandler
+
+import (
+	"context"
+	"database/sql"
+	stderrors "errors"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"go-micro.dev/v4/errors"
+	"jochum.dev/jo-micro/auth2"
+	"jochum.dev/jo-micro/buncomponent"
+	"wz2100.net/microlobby/service/gamedb/v1/db"
+	"wz2100.net/microlobby/shared/badwords"
+	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+)
+
+// errJoinUsed is returned in the transaction when a concurrent request took the join
+var errJoinUsed = errors.BadRequest("INVALID_SECRET", "The secret is invalid or expired")
+
+// hostOf returns the host player of dg or nil
+func hostOf(dg *db.Game) *db.GamePlayer {
+	for _, dp := range dg.Players {
+		if dp.IsHost && dp.IpAddress == dg.HostIp {
+			return dp
+		}
+	}
+
+	return nil
+}
+
+// findPlayer returns the player of dg with the uuid or nil
+func findPlayer(dg *db.Game, playerId uuid.UUID) *db.GamePlayer {
+	for _, dp := range dg.Players {
+		if dp.UUID == playerId {
+			return dp
+		}
+	}
+
+	return nil
+}
+
+// withoutPlayer returns the players of dg without dp
+func withoutPlayer(dg *db.Game, dp *db.GamePlayer) []*db.GamePlayer {
+	result := []*db.GamePlayer{}
+	for _, p := range dg.Players {
+		if p != dp {
+			result = append(result, p)
+		}
+	}
+
+	return result
+}
+
+// keepPlayerFields resets what a host may not change about the players of dg to oldG,
+// hosts move players around but only a player renames itself.
+func keepPlayerFields(user *auth2.User, dg *db.Game, oldG *db.Game) {
+	for _, dp := range dg.Players {
+		oldDp := findPlayer(oldG, dp.UUID)
+		if oldDp == nil {
+			continue
+		}
+
+		dp.IpAddress = oldDp.IpAddress
+		dp.IsHost = oldDp.IsHost
+		if dp.UUID.String() != user.Id {
+			dp.Name = oldDp.Name
+		}
+	}
+}
+
+// leave removes dp from its game, it gives the slot back
+func leave(ctx context.Context, tx bun.Tx, dp *db.GamePlayer) error {
+	now := bun.NullTime{Time: time.Now()}
+	dp.Slot = nil
+	dp.UpdatedAt = now
+	dp.DeletedAt = now
+
+	_, err := tx.NewUpdate().Model(dp).Column("slot", "updated_at", "deleted_at").WherePK().Exec(ctx)
+	return err
+}
+
+// loadGame returns the game with its players
+func (h *Handler) loadGame(ctx context.Context, id string) (*db.Game, error) {
+	gameId, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errors.NotFound("GAME_NOT_FOUND", "Game '%s' not found", id)
+	}
+
+	dg := &db.Game{}
+	err = buncomponent.MustReg(h.cReg).Bun().NewSelect().
+		Model(dg).
+		Relation("Players").
+		Limit(1).
+		Where("g.id = ?", gameId).Scan(ctx)
+	if err == sql.ErrNoRows {
+		return nil, errors.NotFound("GAME_NOT_FOUND", "Game '%s' not found", id)
+	} else if err != nil {
+		return nil, errors.FromError(err)
+	}
+
+	return dg, nil
+}
+
+// isHostOf reports whether user may manage the players of dg
+func isHostOf(user *auth2.User, dg *db.Game) bool {
+	if auth2.IntersectsRoles(user, auth2.RolesServiceAndAdmin...) {
+		return true
+	}
+
+	host := hostOf(dg)
+	return host != nil && host.UUID.String() == user.Id
+}
+
+// checkSlot returns an error when slot is out of range or taken by someone else than dp
+func checkSlot(dg *db.Game, dp *db.GamePlayer, slot uint32) error {
+	if slot >= dg.MaxPlayers {
+		return errors.BadRequest("INVALID_SLOT", "Slot %d is out of range", slot)
+	}
+
+	for _, p := range dg.Players {
+		if p != dp && p.Slot != nil && *p.Slot == slot {
+			return errors.BadRequest("SLOT_TAKEN", "Slot %d is taken", slot)
+		}
+	}
+
+	return nil
+}
+
+// isSlotTaken reports whether err is the unique violation of the slots, a concurrent request took the slot
+// after checkSlot. The driver's error has the SQLSTATE, its message names the constraint.
+func isSlotTaken(err error) bool {
+	var pgErr interface{ SQLState() string }
+	if !stderrors.As(err, &pgErr) {
+		return false
+	}
+
+	return pgErr.SQLState() == "23505" && strings.Contains(err.Error(), "game_players_game_id_slot_key")
+}
+
+// findJoin returns the unused join of playerId for the game with the secret
+func (h *Handler) findJoin(ctx context.Context, gameId uuid.UUID, playerId uuid.UUID, secret string) (*db.GameJoin, error) {
+	join := &db.GameJoin{}
+	err := buncomponent.MustReg(h.cReg).Bun().NewSelect().
+		Model(join).
+		Where("j.secret_hash = ?", hashSecret(secret)).
+		Where("j.game_id = ?", gameId).
+		Where("j.user_id = ?", playerId).
+		Where("j.expires_at > ?", time.Now()).
+		Limit(1).
+		Scan(ctx)
+	if err == sql.ErrNoRows {
+		return nil, errJoinUsed
+	} else if err != nil {
+		return nil, errors.FromError(err)
+	}
+
+	return join, nil
+}
+
+func (h *Handler) AddPlayer(ctx context.Context, in *gamedbpb.AddPlayerRequest, out *gamedbpb.AddPlayerResponse) error {
+	user, err := auth2.ClientAuthMustReg(h.cReg).Plugin().Inspect(ctx)
+	if err != nil {
+		return errors.FromError(err)
+	}
+
+	playerId, err := uuid.Parse(in.PlayerUuid)
+	if err != nil {
+		return errors.BadRequest("INVALID_PLAYER", "Invalid player-uuid '%s'", in.PlayerUuid)
+	}
+
+	dg, err := h.loadGame(ctx, in.Id)
+	if err != nil {
+		return err
+	}
+	gameId := dg.Id
+
+	if !isHostOf(user, dg) {
+		return errors.BadRequest("NOT_ALLOWED", "Only the host can add players")
+	}
+
+	if findPlayer(dg, playerId) != nil {
+		return errors.BadRequest("ALREADY_JOINED", "The player is in that game already")
+	}
+
+	if uint32(len(dg.Players)) >= dg.MaxPlayers {
+		return errors.BadRequest("GAME_FULL", "The game is full")
+	}
+
+	if err := checkSlot(dg, nil, in.Slot); err != nil {
+		return err
+	}
+
+	join, err := h.findJoin(ctx, gameId, playerId, in.Secret)
+	if err != nil {
+		return err
+	}
+
+	slot := in.Slot
+	dp := &db.GamePlayer{
+		GameID:    gameId,
+		UUID:      playerId,
+		Name:      in.Name,
+		IpAddress: in.IpAddress,
+		Slot:      &slot,
+		Team:      in.Team,
+		JoinID:    &join.Id,
+	}
+	if err := h.filterFields(ctx, "PROFANE_PLAYER", badwords.Field{Name: "player name", Value: &dp.Name}); err != nil {
+		return err
+	}
+
+	// Player changes are game updates for the hooks
+	pg := &gamedbpb.Game{}
+	dg.Players = append(dg.Players, dp)
+	if err := dbGameToProto(dg, pg); err != nil {
+		return errors.FromError(err)
+	}
+	if err := h.preUpdate(ctx, pg); err != nil {
+		return err
+	}
+
+	err = buncomponent.MustReg(h.cReg).Bun().RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// A secret works once
+		res, err := tx.NewDelete().Model(join).WherePK().Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n < 1 {
+			return errJoinUsed
+		}
+
+		// A player which left keeps its row, UNIQUE(game_id, uuid) includes deleted ones
+		var old db.GamePlayer
+		err = tx.NewSelect().
+			Model(&old).
+			WhereAllWithDeleted().
+			Where("p.game_id = ?", gameId).
+			Where("p.uuid = ?", playerId).
+			Limit(1).
+			Scan(ctx)
+		if err == sql.ErrNoRows {
+			_, err := tx.NewInsert().Model(dp).Exec(ctx)
+			return err
+		} else if err != nil {
+			return err
+		}
+
+		dp.Id = old.Id
+		dp.CreatedAt = old.CreatedAt
+		dp.UpdatedAt = bun.NullTime{Time: time.Now()}
+		_, err = tx.NewUpdate().
+			Model(dp).
+			Column("name", "ip_address", "is_host", "slot", "team", "join_id", "updated_at", "deleted_at").
+			WhereAllWithDeleted().
+			WherePK().
+			Exec(ctx)
+		return err
+	})
+	if err == errJoinUsed {
+		return err
+	} else if isSlotTaken(err) {
+		return errors.BadRequest("SLOT_TAKEN", "Slot %d is taken", in.Slot)
+	} else if err != nil {
+		return errors.FromError(err)
+	}
+
+	pp, err := dbPlayerToProto(dp)
+	if err != nil {
+		return errors.FromError(err)
+	}
+
+	stats, err := h.playerStats(ctx, playerId)
+	if err != nil {
+		return errors.FromError(err)
+	}
+
+	out.Player = &gamedbpb.PlayerDetails{
+		Uuid:  pp.Uuid,
+		Name:  pp.Name,
+		Stats: stats,
+	}
+
+	h.publishChanges(ctx, &changes{
+		action:        gamedbpb.GameEvent_UPDATED,
+		game:          pg,
+		changedFields: []string{"players"},
+		joined:        []*gamedbpb.Player{pp},
+	})
+
+	return nil
+}
+
+func (h *Handler) UpdatePlayer(ctx context.Context, in *gamedbpb.UpdatePlayerRequest, out *gamedbpb.Player) error {
+	user, err := auth2.ClientAuthMustReg(h.cReg).Plugin().Inspect(ctx)
+	if err != nil {
+		return errors.FromError(err)
+	}
+
+	dg, err := h.loadGame(ctx, in.Id)
+	if err != nil {
+		return err
+	}
+
+	var dp *db.GamePlayer
+	if playerId, err := uuid.Parse(in.Uuid); err == nil {
+		dp = findPlayer(dg, playerId)
+	}
+	if dp == nil {
+		return errors.NotFound("PLAYER_NOT_FOUND", "Player '%s' not found", in.Uuid)
+	}
+
+	isHost := isHostOf(user, dg)
+	if !isHost {
+		if dp.UUID.String() != user.Id {
+			return errors.BadRequest("NOT_ALLOWED", "You can only update yourself")
+		}
+		if in.Slot != nil || in.Team != nil {
+			return errors.BadRequest("NOT_ALLOWED", "Only the host changes slots and teams")
+		}
+	}
+
+	oldPg := &gamedbpb.Game{}
+	if err := dbGameToProto(dg, oldPg); err != nil {
+		return errors.FromError(err)
+	}
+
+	if in.Slot != nil {
+		if err := checkSlot(dg, dp, *in.Slot); err != nil {
+			return err
+		}
+		slot := *in.Slot
+		dp.Slot = &slot
+	}
+	if in.Team != nil {
+		dp.Team = *in.Team
+	}
+	if in.Name != nil {
+		dp.Name = *in.Name
+		if err := h.filterFields(ctx, "PROFANE_PLAYER", badwords.Field{Name: "player name", Value: &dp.Name}); err != nil {
+			return err
+		}
+	}
+
+	pg := &gamedbpb.Game{}
+	if err := dbGameToProto(dg, pg); err != nil {
+		return errors.FromError(err)
+	}
+	if err := h.preUpdate(ctx, pg); err != nil {
+		return err
+	}
+
+	dp.UpdatedAt = bun.NullTime{Time: time.Now()}
+	_, err = buncomponent.MustReg(h.cReg).Bun().NewUpdate().
+		Model(dp).
+		Column("name", "slot", "team", "updated_at").
+		WherePK().
+		Exec(ctx)
+	if isSlotTaken(err) {
+		return errors.BadRequest("SLOT_TAKEN", "Slot %d is taken", *in.Slot)
+	} else if err != nil {
+		return errors.FromError(err)
+	}
+
+	pp, err := dbPlayerToProto(dp)
+	if err != nil {
+		return errors.FromError(err)
+	}
+	out.Uuid = pp.Uuid
+	out.Name = pp.Name
+	out.IpAddress = pp.IpAddress
+	out.IsHost = pp.IsHost
+	out.Slot = pp.Slot
+	out.Team = pp.Team
+
+	if fields := changedFields(oldPg, pg); len(fields) > 0 {
+		h.publishChanges(ctx, &changes{action: gamedbpb.GameEvent_UPDATED, game: pg, changedFields: fields})
+	}
+
+	return nil
+}
+
+func (h *Handler) RemovePlayer(ctx context.Context, in *gamedbpb.RemovePlayerRequest, out *empty.Empty) error {
+	user, err := auth2.ClientAuthMustReg(h.cReg).Plugin().Inspect(ctx)
+	if err != nil {
+		return errors.FromError(err)
+	}
+
+	dg, err := h.loadGame(ctx, in.Id)
+	if err != nil {
+		return err
+	}
+
+	isHost := isHostOf(user, dg)
+	host := hostOf(dg)
+
+	var dp *db.GamePlayer
+	if in.Slot != nil {
+		if !isHost {
+			return errors.BadRequest("NOT_ALLOWED", "Only the host removes players by slot")
+		}
+
+		for _, p := range dg.Players {
+			if p.Slot != nil && *p.Slot == *in.Slot {
+				dp = p
+				break
+			}
+		}
+	} else if playerId, err := uuid.Parse(in.Uuid); err == nil {
+		dp = findPlayer(dg, playerId)
+	}
+	if dp == nil {
+		return errors.NotFound("PLAYER_NOT_FOUND", "Player '%s' not found", in.Uuid)
+	}
+
+	if !isHost && dp.UUID.String() != user.Id {
+		return errors.BadRequest("NOT_ALLOWED", "You can only remove yourself")
+	}
+	if dp == host {
+		return errors.BadRequest("NOT_ALLOWED", "The host leaves by deleting the game")
+	}
+
+	// A kick is the host removing someone, not an admin and not the player itself
+	kicked := host != nil && host.UUID.String() == user.Id
+
+	pp, err := dbPlayerToProto(dp)
+	if err != nil {
+		return errors.FromError(err)
+	}
+
+	pg := &gamedbpb.Game{}
+	dg.Players = withoutPlayer(dg, dp)
+	if err := dbGameToProto(dg, pg); err != nil {
+		return errors.FromError(err)
+	}
+	if err := h.preUpdate(ctx, pg); err != nil {
+		return err
+	}
+
+	err = buncomponent.MustReg(h.cReg).Bun().RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := leave(ctx, tx, dp); err != nil {
+			return err
+		}
+
+		// The player may report it once with the secret of that join, see Kicked
+		if !kicked || dp.JoinID == nil {
+			return nil
+		}
+		_, err := tx.NewUpdate().
+			Model((*db.GameJoin)(nil)).
+			Set("kicked_at = ?", time.Now()).
+			WhereAllWithDeleted().
+			Where("j.id = ?", *dp.JoinID).
+			Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return errors.FromError(err)
+	}
+
+	h.publishChanges(ctx, &changes{
+		action:        gamedbpb.GameEvent_UPDATED,
+		game:          pg,
+		changedFields: []string{"players"},
+		left:          []*gamedbpb.Player{pp},
+	})
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package gamedbhandler
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"go-micro.dev/v4/errors"
+	"jochum.dev/jo-micro/auth2"
+	"wz2100.net/microlobby/service/gamedb/v1/db"
+)
+
+const (
+	hostId   = "00000000-0000-0000-0000-000000000001"
+	playerId = "00000000-0000-0000-0000-000000000002"
+	otherId  = "00000000-0000-0000-0000-000000000003"
+)
+
+// pgError looks like the error of the postgres driver
+type pgError struct {
+	code    string
+	message string
+}
+
+func (e *pgError) Error() string {
+	return fmt.Sprintf("ERROR: %s (SQLSTATE %s)", e.message, e.code)
+}
+
+func (e *pgError) SQLState() string {
+	return e.code
+}
+
+func TestIsSlotTaken(t *testing.T) {
+	slot := &pgError{"23505", `duplicate key value violates unique constraint "game_players_game_id_slot_key"`}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"slot", slot, true},
+		{"wrapped", fmt.Errorf("commit: %w", slot), true},
+		{"other constraint", &pgError{"23505", `duplicate key value violates unique constraint "game_players_game_id_uuid_key"`}, false},
+		{"other state", &pgError{"23503", `insert or update on table "game_players" violates foreign key constraint "game_players_game_id_slot_key"`}, false},
+		{"no driver error", fmt.Errorf("game_players_game_id_slot_key"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isSlotTaken(tt.err); got != tt.want {
+				t.Errorf("isSlotTaken = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckSlot(t *testing.T) {
+	zero, one := uint32(0), uint32(1)
+	a := &db.GamePlayer{Slot: &zero}
+	b := &db.GamePlayer{Slot: &one}
+	legacy := &db.GamePlayer{}
+	dg := &db.Game{MaxPlayers: 4, Players: []*db.GamePlayer{a, b, legacy}}
+
+	tests := []struct {
+		name string
+		dp   *db.GamePlayer
+		slot uint32
+		want string
+	}{
+		{"free", nil, 2, ""},
+		{"last", nil, 3, ""},
+		{"out of range", nil, 4, "INVALID_SLOT"},
+		{"taken", nil, 1, "SLOT_TAKEN"},
+		{"own", b, 1, ""},
+		{"taken by another", a, 1, "SLOT_TAKEN"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if err := checkSlot(dg, tt.dp, tt.slot); err != nil {
+				got = errors.FromError(err).Id
+			}
+			if got != tt.want {
+				t.Errorf("checkSlot = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsHostOf(t *testing.T) {
+	host := &db.GamePlayer{UUID: uuid.MustParse(hostId), IsHost: true, IpAddress: "198.51.100.1"}
+	player := &db.GamePlayer{UUID: uuid.MustParse(playerId), IpAddress: "198.51.100.2"}
+	dg := &db.Game{HostIp: "198.51.100.1", Players: []*db.GamePlayer{player, host}}
+	// The host left, a player with IsHost but another IP doesn't count
+	gone := &db.Game{HostIp: "198.51.100.1", Players: []*db.GamePlayer{{UUID: uuid.MustParse(otherId), IsHost: true, IpAddress: "203.0.113.1"}}}
+
+	if got := hostOf(dg); got != host {
+		t.Errorf("hostOf = %v, want the host", got)
+	}
+	if got := hostOf(gone); got != nil {
+		t.Errorf("hostOf a game without host = %v", got)
+	}
+
+	tests := []struct {
+		name string
+		user *auth2.User
+		dg   *db.Game
+		want bool
+	}{
+		{"host", &auth2.User{Id: hostId}, dg, true},
+		{"player", &auth2.User{Id: playerId}, dg, false},
+		{"admin", &auth2.User{Id: otherId, Roles: []string{"admin"}}, dg, true},
+		{"no host", &auth2.User{Id: otherId}, gone, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isHostOf(tt.user, tt.dg); got != tt.want {
+				t.Errorf("isHostOf = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindPlayer(t *testing.T) {
+	host := &db.GamePlayer{UUID: uuid.MustParse(hostId)}
+	player := &db.GamePlayer{UUID: uuid.MustParse(playerId)}
+	dg := &db.Game{Players: []*db.GamePlayer{host, player}}
+
+	if got := findPlayer(dg, uuid.MustParse(playerId)); got != player {
+		t.Errorf("findPlayer = %v, want the player", got)
+	}
+	if got := findPlayer(dg, uuid.MustParse(otherId)); got != nil {
+		t.Errorf("findPlayer of a stranger = %v", got)
+	}
+
+	got := withoutPlayer(dg, player)
+	if len(got) != 1 || got[0] != host || len(dg.Players) != 2 {
+		t.Errorf("withoutPlayer = %v, players %v", got, dg.Players)
+	}
+}
+
+func TestKeepPlayerFields(t *testing.T) {
+	oldG := &db.Game{HostIp: "198.51.100.1", Players: []*db.GamePlayer{
+		{UUID: uuid.MustParse(hostId), Name: "host", IsHost: true, IpAddress: "198.51.100.1"},
+		{UUID: uuid.MustParse(playerId), Name: "player", IpAddress: "198.51.100.2"},
+	}}
+	one, two := uint32(1), uint32(2)
+	dg := &db.Game{HostIp: "198.51.100.1", Players: []*db.GamePlayer{
+		{UUID: uuid.MustParse(hostId), Name: "new host", IsHost: true, IpAddress: "198.51.100.1", Slot: &one},
+		{UUID: uuid.MustParse(playerId), Name: "renamed", IsHost: true, IpAddress: "203.0.113.1", Slot: &two, Team: 1},
+	}}
+
+	keepPlayerFields(&auth2.User{Id: hostId}, dg, oldG)
+
+	host, player := dg.Players[0], dg.Players[1]
+	if host.Name != "new host" || *host.Slot != 1 {
+		t.Errorf("the host can't change itself: %+v", host)
+	}
+	if player.Name != "player" || player.IsHost || player.IpAddress != "198.51.100.2" {
+		t.Errorf("the host changed a player: %+v", player)
+	}
+	if *player.Slot != 2 || player.Team != 1 {
+		t.Errorf("the host can't move a player: %+v", player)
+	}
+}
@@ -0,0 +1,75 @@
+package gamedbhandler
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"jochum.dev/jo-micro/buncomponent"
+	"wz2100.net/microlobby/service/gamedb/v1/db"
+	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+)
+
+// recentStats is the window of the "recent" counters
+const recentStats = 30 * 24 * time.Hour
+
+// playerCounters counts what the player did since, a zero since counts everything.
+// gamedb doesn't record reports and abandons yet, they stay 0.
+// playersKicked counts the kicks the kicked players reported, see Kicked.
+func (h *Handler) playerCounters(ctx context.Context, playerId uuid.UUID, since time.Time) (*gamedbpb.PlayerCounters, error) {
+	count := func(host bool) (int, error) {
+		q := buncomponent.MustReg(h.cReg).Bun().NewSelect().
+			Model((*db.GamePlayer)(nil)).
+			WhereAllWithDeleted().
+			Where("p.uuid = ?", playerId)
+		if !since.IsZero() {
+			q = q.Where("p.created_at > ?", since)
+		}
+		if host {
+			q = q.Where("p.is_host")
+		}
+
+		return q.Count(ctx)
+	}
+
+	games, err := count(false)
+	if err != nil {
+		return nil, err
+	}
+
+	hosted, err := count(true)
+	if err != nil {
+		return nil, err
+	}
+
+	q := buncomponent.MustReg(h.cReg).Bun().NewSelect().
+		Model((*db.GameKick)(nil)).
+		Where("k.host_uuid = ?", playerId)
+	if !since.IsZero() {
+		q = q.Where("k.created_at > ?", since)
+	}
+	kicked, err := q.Count(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gamedbpb.PlayerCounters{
+		Games:         uint64(games),
+		Hosted:        uint64(hosted),
+		PlayersKicked: uint64(kicked),
+	}, nil
+}
+
+func (h *Handler) playerStats(ctx context.Context, playerId uuid.UUID) (*gamedbpb.PlayerStats, error) {
+	lifetime, err := h.playerCounters(ctx, playerId, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	recent, err := h.playerCounters(ctx, playerId, time.Now().Add(-recentStats))
+	if err != nil {
+		return nil, err
+	}
+
+	return &gamedbpb.PlayerStats{Lifetime: lifetime, Recent: recent}, nil
+}
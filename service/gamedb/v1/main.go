@@ -13,6 +13,7 @@ import (
 	"jochum.dev/jo-micro/router"
 	"wz2100.net/microlobby/service/gamedb/v1/config"
 	"wz2100.net/microlobby/service/gamedb/v1/gamedbhandler"
+	"wz2100.net/microlobby/service/settings"
 	_ "wz2100.net/microlobby/shared/micro_plugins"
 	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
 )
@@ -27,6 +28,7 @@ func main() {
 		buncomponent.New(),
 		gamedbhandler.New(),
 		router.New(),
+		settings.New(),
 	)
 
 	auth2ClientReg := auth2.ClientAuthMustReg(cReg)
@@ -64,6 +66,38 @@ func main() {
 					endpointroles.Endpoint(gamedbpb.GameDBV1Service.Delete),
 					endpointroles.RolesAllow(auth2.RolesServiceAndUsersAndAdmin),
 				),
+				endpointroles.NewRule(
+					endpointroles.Endpoint(gamedbpb.GameDBV1Service.NextV3GameId),
+					endpointroles.RolesAllow(auth2.RolesServiceAndAdmin),
+				),
+				endpointroles.NewRule(
+					endpointroles.Endpoint(gamedbpb.GameDBV1Service.Motd),
+					endpointroles.RolesAllow(auth2.RolesAllAndAnon),
+				),
+				endpointroles.NewRule(
+					endpointroles.Endpoint(gamedbpb.GameDBV1Service.Get),
+					endpointroles.RolesAllow(auth2.RolesAllAndAnon),
+				),
+				endpointroles.NewRule(
+					endpointroles.Endpoint(gamedbpb.GameDBV1Service.Join),
+					endpointroles.RolesAllow(auth2.RolesServiceAndUsersAndAdmin),
+				),
+				endpointroles.NewRule(
+					endpointroles.Endpoint(gamedbpb.GameDBV1Service.AddPlayer),
+					endpointroles.RolesAllow(auth2.RolesServiceAndUsersAndAdmin),
+				),
+				endpointroles.NewRule(
+					endpointroles.Endpoint(gamedbpb.GameDBV1Service.UpdatePlayer),
+					endpointroles.RolesAllow(auth2.RolesServiceAndUsersAndAdmin),
+				),
+				endpointroles.NewRule(
+					endpointroles.Endpoint(gamedbpb.GameDBV1Service.RemovePlayer),
+					endpointroles.RolesAllow(auth2.RolesServiceAndUsersAndAdmin),
+				),
+				endpointroles.NewRule(
+					endpointroles.Endpoint(gamedbpb.GameDBV1Service.Kicked),
+					endpointroles.RolesAllow(auth2.RolesServiceAndUsersAndAdmin),
+				),
 			)
 			auth2ClientReg.Plugin().AddVerifier(authVerifier)
 
@@ -0,0 +1,8 @@
+BEGIN;
+
+DROP INDEX IF EXISTS public.v3_game_id_idx;
+DROP SEQUENCE IF EXISTS public.v3_game_id_seq;
+
+ALTER TABLE public.games ALTER COLUMN v3_game_id TYPE INTEGER;
+
+COMMIT;
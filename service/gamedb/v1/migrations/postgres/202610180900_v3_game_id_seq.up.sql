@@ -0,0 +1,9 @@
+BEGIN;
+
+-- lobby v3 game ids are uint32 on the wire, INTEGER can't hold the upper half
+ALTER TABLE public.games ALTER COLUMN v3_game_id TYPE BIGINT;
+
+CREATE SEQUENCE public.v3_game_id_seq AS BIGINT MINVALUE 1 MAXVALUE 4294967295 CYCLE;
+CREATE INDEX v3_game_id_idx ON public.games (v3_game_id) WHERE (deleted_at IS NULL);
+
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP SEQUENCE IF EXISTS public.game_event_seq;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+-- Sequence numbers of GameEvents, gateways use them as resume tokens
+CREATE SEQUENCE public.game_event_seq AS BIGINT MINVALUE 1;
+
+COMMIT;
@@ -0,0 +1,22 @@
+BEGIN;
+
+-- Join intents, the secret goes to the joining player and the host validates it later
+CREATE TABLE public.game_joins
+(
+    id BIGSERIAL PRIMARY KEY,
+    game_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    secret_hash varchar(64) COLLATE pg_catalog."default" NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+
+    created_at TIMESTAMPTZ DEFAULT Now() NOT NULL,
+    updated_at TIMESTAMPTZ NULL,
+    deleted_at TIMESTAMPTZ NULL,
+
+    UNIQUE(secret_hash),
+    FOREIGN KEY(game_id) REFERENCES public.games(id) ON DELETE CASCADE
+);
+CREATE INDEX game_joins_game_id_idx ON public.game_joins (game_id) WHERE (deleted_at IS NULL);
+CREATE INDEX game_joins_user_id_created_at_idx ON public.game_joins (user_id, created_at);
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE public.game_players DROP CONSTRAINT IF EXISTS game_players_game_id_slot_key;
+ALTER TABLE public.game_players DROP COLUMN IF EXISTS team;
+ALTER TABLE public.game_players DROP COLUMN IF EXISTS slot;
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+-- Legacy lobby players have no slot, NULLs don't collide
+ALTER TABLE public.game_players ADD COLUMN slot INTEGER NULL;
+ALTER TABLE public.game_players ADD COLUMN team INTEGER DEFAULT 0 NOT NULL;
+
+-- Deferred so a host can swap slots in one update, players which leave give their slot back
+ALTER TABLE public.game_players ADD CONSTRAINT game_players_game_id_slot_key UNIQUE (game_id, slot) DEFERRABLE INITIALLY DEFERRED;
+
+COMMIT;
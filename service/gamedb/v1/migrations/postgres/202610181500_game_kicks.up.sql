@@ -0,0 +1,23 @@
+BEGIN;
+
+-- Kicks reported by the kicked players, they count for the host
+CREATE TABLE public.game_kicks
+(
+    id BIGSERIAL PRIMARY KEY,
+    game_id UUID NOT NULL,
+    join_id BIGINT NOT NULL,
+    host_uuid UUID NOT NULL,
+    player_uuid UUID NOT NULL,
+
+    created_at TIMESTAMPTZ DEFAULT Now() NOT NULL,
+    updated_at TIMESTAMPTZ NULL,
+    deleted_at TIMESTAMPTZ NULL,
+
+    UNIQUE(join_id),
+    FOREIGN KEY(game_id) REFERENCES public.games(id) ON DELETE CASCADE,
+    FOREIGN KEY(join_id) REFERENCES public.game_joins(id) ON DELETE CASCADE
+);
+CREATE INDEX game_kicks_host_uuid_created_at_idx ON public.game_kicks (host_uuid, created_at);
+CREATE INDEX game_kicks_player_uuid_idx ON public.game_kicks (player_uuid);
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE public.game_joins DROP COLUMN IF EXISTS reported_at;
+ALTER TABLE public.game_joins DROP COLUMN IF EXISTS kicked_at;
+ALTER TABLE public.game_players DROP COLUMN IF EXISTS join_id;
+
+COMMIT;
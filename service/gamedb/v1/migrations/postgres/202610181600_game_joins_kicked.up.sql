@@ -0,0 +1,10 @@
+BEGIN;
+
+-- The join a player used, a kick report needs it
+ALTER TABLE public.game_players ADD COLUMN join_id BIGINT NULL REFERENCES public.game_joins(id) ON DELETE SET NULL;
+
+-- kicked_at is when the host removed the player of the join, reported_at when the player reported it
+ALTER TABLE public.game_joins ADD COLUMN kicked_at TIMESTAMPTZ NULL;
+ALTER TABLE public.game_joins ADD COLUMN reported_at TIMESTAMPTZ NULL;
+
+COMMIT;
@@ -0,0 +1,9 @@
+package config
+
+var (
+	Version = "not set"
+)
+
+const (
+	Name = "microlobby.gateway.v1"
+)
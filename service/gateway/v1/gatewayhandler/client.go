@@ -0,0 +1,184 @@
+package gatewayhandler
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"jochum.dev/jo-micro/auth2"
+	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+	"wz2100.net/microlobby/shared/visibility"
+)
+
+const (
+	writeTimeout = 10 * time.Second
+	pongTimeout  = 60 * time.Second
+	pingInterval = 30 * time.Second
+
+	// queueSize is the number of events a client may lag behind before it gets disconnected
+	queueSize = 64
+)
+
+const (
+	MessageSnapshot = "snapshot"
+	MessageCreated  = "created"
+	MessageUpdated  = "updated"
+	MessageDeleted  = "deleted"
+)
+
+// message is what clients receive as JSON
+type message struct {
+	Type  string            `json:"type"`
+	Games []json.RawMessage `json:"games,omitempty"`
+	Game  json.RawMessage   `json:"game,omitempty"`
+	Id    string            `json:"id,omitempty"`
+}
+
+var marshaler = protojson.MarshalOptions{EmitUnpopulated: true}
+
+// view returns g the way user sees it or nil if user may not know about it, user is nil for
+// anonymous clients. gamedb applies the same rules to its List and Get.
+func view(user *auth2.User, g *gamedbpb.Game) *gamedbpb.Game {
+	v := visibility.ViewerOf(user, g)
+	if !v.CanSee(g) {
+		return nil
+	}
+	if v >= visibility.Host {
+		return g
+	}
+
+	userId := ""
+	if user != nil {
+		userId = user.Id
+	}
+
+	rg := proto.Clone(g).(*gamedbpb.Game)
+	v.Redact(userId, rg)
+	return rg
+}
+
+type client struct {
+	*subscription
+
+	conn *websocket.Conn
+	user *auth2.User
+
+	// visible are the ids of the games the client knows, only writeLoop uses it
+	visible map[string]struct{}
+}
+
+func newClient(conn *websocket.Conn, user *auth2.User) *client {
+	return &client{
+		subscription: newSubscription(func() { conn.Close() }),
+		conn:         conn,
+		user:         user,
+		visible:      make(map[string]struct{}),
+	}
+}
+
+// delta translates an event into what this client sees, visibility changes become created or deleted.
+func (c *client) delta(ev *gamedbpb.GameEvent) (*message, error) {
+	g := ev.Game
+	_, known := c.visible[g.Id]
+
+	var vg *gamedbpb.Game
+	if ev.Action != gamedbpb.GameEvent_DELETED {
+		vg = view(c.user, g)
+	}
+
+	switch {
+	case vg != nil:
+		data, err := marshaler.Marshal(vg)
+		if err != nil {
+			return nil, err
+		}
+
+		c.visible[g.Id] = struct{}{}
+		if known {
+			return &message{Type: MessageUpdated, Game: data}, nil
+		}
+		return &message{Type: MessageCreated, Game: data}, nil
+	case known:
+		delete(c.visible, g.Id)
+		return &message{Type: MessageDeleted, Id: g.Id}, nil
+	}
+
+	return nil, nil
+}
+
+func (c *client) write(m *message) error {
+	if err := c.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+
+	return c.conn.WriteJSON(m)
+}
+
+// writeLoop sends the snapshot and then the deltas until the client is gone
+func (c *client) writeLoop(games []*gamedbpb.Game) error {
+	defer c.close()
+
+	snapshot := &message{Type: MessageSnapshot, Games: []json.RawMessage{}}
+	for _, g := range games {
+		vg := view(c.user, g)
+		if vg == nil {
+			continue
+		}
+
+		data, err := marshaler.Marshal(vg)
+		if err != nil {
+			return err
+		}
+
+		c.visible[g.Id] = struct{}{}
+		snapshot.Games = append(snapshot.Games, data)
+	}
+	if err := c.write(snapshot); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return nil
+		case ev := <-c.events:
+			m, err := c.delta(ev)
+			if err != nil {
+				return err
+			}
+			if m == nil {
+				continue
+			}
+
+			if err := c.write(m); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// readLoop only handles pongs and notices a closed connection, clients don't send anything
+func (c *client) readLoop() {
+	defer c.close()
+
+	c.conn.SetReadLimit(512)
+	c.conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	})
+
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package gatewayhandler
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"jochum.dev/jo-micro/auth2"
+	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+)
+
+const (
+	hostId   = "00000000-0000-0000-0000-000000000001"
+	playerId = "00000000-0000-0000-0000-000000000002"
+	otherId  = "00000000-0000-0000-0000-000000000003"
+)
+
+var (
+	host   = &auth2.User{Id: hostId}
+	player = &auth2.User{Id: playerId}
+	other  = &auth2.User{Id: otherId}
+	admin  = &auth2.User{Id: otherId, Roles: []string{auth2.ROLE_ADMIN}}
+)
+
+func testGame(id string, private bool) *gamedbpb.Game {
+	return &gamedbpb.Game{
+		Id:           id,
+		HostIp:       "198.51.100.1",
+		IsPrivate:    private,
+		V3GameId:     42,
+		LobbyVersion: 3,
+		Players: []*gamedbpb.Player{
+			{Uuid: hostId, Name: "host", IsHost: true, IpAddress: "198.51.100.1"},
+			{Uuid: playerId, Name: "player", IpAddress: "198.51.100.2"},
+		},
+	}
+}
+
+func TestView(t *testing.T) {
+	tests := []struct {
+		name      string
+		user      *auth2.User
+		private   bool
+		visible   bool
+		hostIp    string
+		uuids     bool
+		internals bool
+	}{
+		{"anonymous", nil, false, true, "", false, false},
+		{"anonymous private", nil, true, false, "", false, false},
+		{"user", other, false, true, "", true, false},
+		{"user private", other, true, false, "", true, false},
+		{"player private", player, true, true, "198.51.100.1", true, false},
+		{"host private", host, true, true, "198.51.100.1", true, true},
+		{"admin private", admin, true, true, "198.51.100.1", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := testGame("a", tt.private)
+			vg := view(tt.user, g)
+			if (vg != nil) != tt.visible {
+				t.Fatalf("view = %v, want visible %v", vg, tt.visible)
+			}
+			if vg == nil {
+				return
+			}
+
+			if vg.HostIp != tt.hostIp {
+				t.Errorf("HostIp = %q, want %q", vg.HostIp, tt.hostIp)
+			}
+			if (vg.Players[0].Uuid != "") != tt.uuids {
+				t.Errorf("Uuid = %q", vg.Players[0].Uuid)
+			}
+			if (vg.V3GameId != 0) != tt.internals || (vg.LobbyVersion != 0) != tt.internals {
+				t.Errorf("V3GameId = %d, LobbyVersion = %d", vg.V3GameId, vg.LobbyVersion)
+			}
+			if g.HostIp == "" || g.V3GameId == 0 || g.Players[0].Uuid == "" {
+				t.Error("view changed the original game")
+			}
+		})
+	}
+}
+
+func TestClientDelta(t *testing.T) {
+	steps := []struct {
+		name    string
+		action  gamedbpb.GameEvent_Action
+		private bool
+		want    string
+	}{
+		{"created", gamedbpb.GameEvent_CREATED, false, MessageCreated},
+		{"updated", gamedbpb.GameEvent_UPDATED, false, MessageUpdated},
+		{"went private", gamedbpb.GameEvent_UPDATED, true, MessageDeleted},
+		{"private again", gamedbpb.GameEvent_UPDATED, true, ""},
+		{"public again", gamedbpb.GameEvent_UPDATED, false, MessageCreated},
+		{"deleted", gamedbpb.GameEvent_DELETED, false, MessageDeleted},
+		{"deleted again", gamedbpb.GameEvent_DELETED, false, ""},
+		{"private created", gamedbpb.GameEvent_CREATED, true, ""},
+	}
+
+	c := &client{user: other, visible: make(map[string]struct{})}
+	for _, s := range steps {
+		m, err := c.delta(&gamedbpb.GameEvent{Action: s.action, Game: testGame("a", s.private)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := ""
+		if m != nil {
+			got = m.Type
+		}
+		if got != s.want {
+			t.Errorf("%s: delta = %q, want %q", s.name, got, s.want)
+		}
+	}
+
+	// Players see their private games, admins see all
+	for _, user := range []*auth2.User{player, admin} {
+		c := &client{user: user, visible: make(map[string]struct{})}
+		m, err := c.delta(&gamedbpb.GameEvent{Action: gamedbpb.GameEvent_CREATED, Game: testGame("b", true)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m == nil || m.Type != MessageCreated {
+			t.Errorf("delta for %s = %v, want created", user.Id, m)
+		}
+	}
+}
+
+func TestRequestToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		header string
+		want   string
+	}{
+		{"none", "/ws", "", ""},
+		{"header", "/ws", "Bearer abc", "abc"},
+		{"query", "/ws?access_token=def", "", "def"},
+		{"header wins", "/ws?access_token=def", "Bearer abc", "abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.url, nil)
+			if len(tt.header) > 0 {
+				r.Header.Set("Authorization", tt.header)
+			}
+
+			if got := requestToken(r); got != tt.want {
+				t.Errorf("requestToken = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package gatewayhandler
+
+import (
+	"sort"
+	"sync"
+
+	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+)
+
+// historySize is the number of events kept for consumers which resume with their last event id.
+// Each replica keeps its own history from the time it started.
+const historySize = 1024
+
+// subscription receives the events of a feed until it's closed
+type subscription struct {
+	events    chan *gamedbpb.GameEvent
+	done      chan struct{}
+	closeOnce sync.Once
+	onClose   func()
+}
+
+func newSubscription(onClose func()) *subscription {
+	return &subscription{
+		events:  make(chan *gamedbpb.GameEvent, queueSize),
+		done:    make(chan struct{}),
+		onClose: onClose,
+	}
+}
+
+// push queues an event, a subscriber which can't keep up gets disconnected and has to subscribe again
+func (s *subscription) push(ev *gamedbpb.GameEvent) {
+	select {
+	case s.events <- ev:
+	default:
+		s.close()
+	}
+}
+
+func (s *subscription) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		if s.onClose != nil {
+			s.onClose()
+		}
+	})
+}
+
+// feed fans gamedb events out to the subscriptions and remembers the latest of them
+type feed struct {
+	lock    sync.Mutex
+	subs    map[*subscription]struct{}
+	history []*gamedbpb.GameEvent
+	last    uint64
+}
+
+func newFeed() *feed {
+	return &feed{
+		subs:    make(map[*subscription]struct{}),
+		history: make([]*gamedbpb.GameEvent, 0, historySize),
+	}
+}
+
+func (f *feed) publish(ev *gamedbpb.GameEvent) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	// Events without a sequence can't be resumed
+	if ev.Sequence > 0 {
+		f.remember(ev)
+		if ev.Sequence > f.last {
+			f.last = ev.Sequence
+		}
+	}
+
+	for s := range f.subs {
+		s.push(ev)
+	}
+}
+
+// remember adds ev to the history, the broker may deliver events out of order so it keeps them sorted
+func (f *feed) remember(ev *gamedbpb.GameEvent) {
+	i := sort.Search(len(f.history), func(i int) bool { return f.history[i].Sequence > ev.Sequence })
+
+	if len(f.history) == historySize {
+		// Older than all we keep
+		if i == 0 {
+			return
+		}
+
+		copy(f.history, f.history[1:i])
+		f.history[i-1] = ev
+		return
+	}
+
+	f.history = append(f.history, nil)
+	copy(f.history[i+1:], f.history[i:])
+	f.history[i] = ev
+}
+
+// subscribe registers s and returns the sequence of the latest event. When since is given and
+// still in the history it also returns the events after it, ok is false when the caller
+// needs a snapshot because the events after since are unknown.
+func (f *feed) subscribe(s *subscription, since uint64) (last uint64, missed []*gamedbpb.GameEvent, ok bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.subs[s] = struct{}{}
+
+	if since == 0 || since > f.last {
+		return f.last, nil, false
+	}
+	if since == f.last {
+		return f.last, nil, true
+	}
+	if len(f.history) == 0 || since < f.history[0].Sequence-1 {
+		return f.last, nil, false
+	}
+
+	for _, ev := range f.history {
+		if ev.Sequence > since {
+			missed = append(missed, ev)
+		}
+	}
+
+	return f.last, missed, true
+}
+
+func (f *feed) unsubscribe(s *subscription) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	delete(f.subs, s)
+}
+
+// closeAll closes all subscriptions, Shutdown doesn't know about hijacked and streaming connections
+func (f *feed) closeAll() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for s := range f.subs {
+		s.close()
+	}
+}
@@ -0,0 +1,127 @@
+package gatewayhandler
+
+import (
+	"reflect"
+	"testing"
+
+	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+)
+
+func sequences(evs []*gamedbpb.GameEvent) []uint64 {
+	result := []uint64{}
+	for _, ev := range evs {
+		result = append(result, ev.Sequence)
+	}
+
+	return result
+}
+
+func TestFeedPublish(t *testing.T) {
+	tests := []struct {
+		name    string
+		publish []uint64
+		history []uint64
+		last    uint64
+	}{
+		{"in order", []uint64{1, 2, 3}, []uint64{1, 2, 3}, 3},
+		{"out of order", []uint64{1, 3, 2}, []uint64{1, 2, 3}, 3},
+		{"late", []uint64{5, 6, 1}, []uint64{1, 5, 6}, 6},
+		{"no sequence", []uint64{1, 0, 2}, []uint64{1, 2}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFeed()
+			for _, seq := range tt.publish {
+				f.publish(&gamedbpb.GameEvent{Sequence: seq})
+			}
+
+			if got := sequences(f.history); !reflect.DeepEqual(got, tt.history) {
+				t.Errorf("history = %v, want %v", got, tt.history)
+			}
+			if f.last != tt.last {
+				t.Errorf("last = %d, want %d", f.last, tt.last)
+			}
+		})
+	}
+}
+
+func TestFeedHistoryFull(t *testing.T) {
+	f := newFeed()
+	for seq := uint64(1); seq <= historySize; seq++ {
+		f.publish(&gamedbpb.GameEvent{Sequence: seq * 2})
+	}
+
+	// Older than the history, it's gone
+	f.publish(&gamedbpb.GameEvent{Sequence: 1})
+	if len(f.history) != historySize || f.history[0].Sequence != 2 {
+		t.Fatalf("history starts with %d, len %d", f.history[0].Sequence, len(f.history))
+	}
+
+	// In between, the oldest makes room
+	f.publish(&gamedbpb.GameEvent{Sequence: 7})
+	if got := sequences(f.history[:4]); !reflect.DeepEqual(got, []uint64{4, 6, 7, 8}) {
+		t.Errorf("history starts with %v", got)
+	}
+	if len(f.history) != historySize || f.last != historySize*2 {
+		t.Errorf("len %d, last %d", len(f.history), f.last)
+	}
+}
+
+func TestFeedSubscribe(t *testing.T) {
+	f := newFeed()
+	for _, seq := range []uint64{10, 11, 13, 12} {
+		f.publish(&gamedbpb.GameEvent{Sequence: seq})
+	}
+
+	tests := []struct {
+		name   string
+		since  uint64
+		missed []uint64
+		ok     bool
+	}{
+		{"fresh", 0, []uint64{}, false},
+		{"current", 13, []uint64{}, true},
+		{"resume", 11, []uint64{12, 13}, true},
+		{"right before the history", 9, []uint64{10, 11, 12, 13}, true},
+		{"too old", 8, []uint64{}, false},
+		{"unknown", 14, []uint64{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSubscription(nil)
+			last, missed, ok := f.subscribe(s, tt.since)
+			defer f.unsubscribe(s)
+
+			if last != 13 {
+				t.Errorf("last = %d, want 13", last)
+			}
+			if ok != tt.ok {
+				t.Errorf("ok = %v, want %v", ok, tt.ok)
+			}
+			if got := sequences(missed); !reflect.DeepEqual(got, tt.missed) {
+				t.Errorf("missed = %v, want %v", got, tt.missed)
+			}
+		})
+	}
+}
+
+func TestSubscriptionOverflow(t *testing.T) {
+	closed := 0
+	s := newSubscription(func() { closed++ })
+
+	for i := 0; i <= queueSize; i++ {
+		s.push(&gamedbpb.GameEvent{})
+	}
+	s.close()
+
+	select {
+	case <-s.done:
+	default:
+		t.Error("a full subscription isn't closed")
+	}
+	if closed != 1 {
+		t.Errorf("onClose ran %d times, want 1", closed)
+	}
+}
@@ -0,0 +1,216 @@
+package gatewayhandler
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/urfave/cli/v2"
+	"go-micro.dev/v4"
+	"go-micro.dev/v4/errors"
+	"go-micro.dev/v4/metadata"
+	"jochum.dev/jo-micro/auth2"
+	"jochum.dev/jo-micro/components"
+	"jochum.dev/jo-micro/logruscomponent"
+	gamedbConfig "wz2100.net/microlobby/service/gamedb/v1/config"
+	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+	"wz2100.net/microlobby/shared/utils"
+)
+
+const Name = "gatewayHandler"
+
+type Handler struct {
+	cReg        *components.Registry
+	initialized bool
+
+	server   *http.Server
+	upgrader websocket.Upgrader
+
+	feed *feed
+}
+
+func New() *Handler {
+	return &Handler{
+		initialized: false,
+		upgrader: websocket.Upgrader{
+			// Clients authenticate with a token and not with cookies, spectator sites connect from everywhere
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		feed: newFeed(),
+	}
+}
+
+func MustReg(cReg *components.Registry) *Handler {
+	return cReg.Must(Name).(*Handler)
+}
+
+func (h *Handler) Name() string {
+	return Name
+}
+
+func (h *Handler) Priority() int {
+	return 100
+}
+
+func (h *Handler) Initialized() bool {
+	return h.initialized
+}
+
+func (h *Handler) Init(components *components.Registry, cli *cli.Context) error {
+	if h.initialized {
+		return nil
+	}
+
+	h.cReg = components
+
+	// No queue, every gateway has its own clients
+	if err := micro.RegisterSubscriber(gamedbConfig.TopicEvents, h.cReg.Service().Server(), h.onGameEvent); err != nil {
+		return errors.FromError(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", h.serveWS)
+	mux.HandleFunc("/events", h.serveSSE)
+	h.server = &http.Server{
+		Addr:              cli.String("gateway_listen"),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	listener, err := net.Listen("tcp", h.server.Addr)
+	if err != nil {
+		return errors.FromError(err)
+	}
+
+	logger := logruscomponent.MustReg(h.cReg).Logger()
+	logger.Infof("Gateway listening on: %s", h.server.Addr)
+	go func() {
+		if err := h.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.Error(err)
+		}
+	}()
+
+	h.initialized = true
+	return nil
+}
+
+func (h *Handler) Stop() error {
+	if h.server == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := h.server.Shutdown(ctx)
+
+	h.feed.closeAll()
+
+	return err
+}
+
+func (h *Handler) Flags(r *components.Registry) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "gateway_listen",
+			Usage: "Address of the WebSocket and SSE server",
+			Value: ":8090",
+		},
+	}
+}
+
+func (h *Handler) Health(context context.Context) error {
+	return nil
+}
+
+func (h *Handler) gameDBClient() (gamedbpb.GameDBV1Service, error) {
+	// Wait until the service is here
+	_, err := utils.ServiceRetryGet(h.cReg.Service(), gamedbConfig.Name, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	return gamedbpb.NewGameDBV1Service(gamedbConfig.Name, h.cReg.Service().Client()), nil
+}
+
+// snapshot returns all current games
+func (h *Handler) snapshot(ctx context.Context) ([]*gamedbpb.Game, error) {
+	ctx, err := auth2.ClientAuthMustReg(h.cReg).Plugin().ServiceContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	gamedb, err := h.gameDBClient()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := gamedb.List(ctx, &gamedbpb.ListRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Games, nil
+}
+
+func (h *Handler) onGameEvent(ctx context.Context, ev *gamedbpb.GameEvent) error {
+	h.feed.publish(ev)
+	return nil
+}
+
+// requestToken returns the token of a request, browsers can't set headers for WebSockets so it may be in the query
+func requestToken(r *http.Request) string {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if len(token) < 1 {
+		token = r.URL.Query().Get("access_token")
+	}
+
+	return token
+}
+
+func (h *Handler) inspect(ctx context.Context, token string) (*auth2.User, error) {
+	if len(token) < 1 {
+		return nil, errors.Unauthorized("NO_TOKEN", "No access token given")
+	}
+
+	ctx = metadata.Set(ctx, "Authorization", "Bearer "+token)
+	return auth2.ClientAuthMustReg(h.cReg).Plugin().Inspect(ctx)
+}
+
+func (h *Handler) serveWS(w http.ResponseWriter, r *http.Request) {
+	logger := logruscomponent.MustReg(h.cReg).Logger().WithField("remote", r.RemoteAddr)
+
+	user, err := h.inspect(r.Context(), requestToken(r))
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade answered the client already
+		logger.Debug(err)
+		return
+	}
+
+	c := newClient(conn, user)
+
+	// Register before the snapshot, events which arrive meanwhile wait in the queue
+	h.feed.subscribe(c.subscription, 0)
+	defer h.feed.unsubscribe(c.subscription)
+
+	games, err := h.snapshot(r.Context())
+	if err != nil {
+		logger.Error(err)
+		c.close()
+		return
+	}
+
+	logger.WithField("user", user.Id).Debug("Client subscribed")
+	go c.readLoop()
+	if err := c.writeLoop(games); err != nil {
+		logger.Debug(err)
+	}
+}
@@ -0,0 +1,162 @@
+package gatewayhandler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"jochum.dev/jo-micro/auth2"
+	"jochum.dev/jo-micro/logruscomponent"
+	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+)
+
+// keepAliveInterval keeps proxies from closing idle streams
+const keepAliveInterval = 30 * time.Second
+
+// sseEvent translates an event for a stream, streams don't track what the consumer knows so
+// they can be resumed anywhere. A game which the consumer may no longer see is deleted for it.
+func sseEvent(user *auth2.User, ev *gamedbpb.GameEvent) (string, *gamedbpb.Game) {
+	g := ev.Game
+	if ev.Action == gamedbpb.GameEvent_DELETED {
+		return MessageDeleted, &gamedbpb.Game{Id: g.Id}
+	}
+
+	vg := view(user, g)
+	switch {
+	case vg != nil:
+		if ev.Action == gamedbpb.GameEvent_CREATED {
+			return MessageCreated, vg
+		}
+		return MessageUpdated, vg
+	case ev.Action == gamedbpb.GameEvent_UPDATED:
+		return MessageDeleted, &gamedbpb.Game{Id: g.Id}
+	}
+
+	return "", nil
+}
+
+func writeSSE(w http.ResponseWriter, id uint64, event string, data []byte) error {
+	if id > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", id); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
+
+func writeSSEGameEvent(w http.ResponseWriter, user *auth2.User, ev *gamedbpb.GameEvent) error {
+	event, g := sseEvent(user, ev)
+	if g == nil {
+		return nil
+	}
+
+	data, err := marshaler.Marshal(g)
+	if err != nil {
+		return err
+	}
+
+	return writeSSE(w, ev.Sequence, event, data)
+}
+
+// serveSSE streams game changes as Server-Sent Events, a token is optional. Consumers resume
+// with the Last-Event-ID header or the last_event_id query parameter.
+func (h *Handler) serveSSE(w http.ResponseWriter, r *http.Request) {
+	logger := logruscomponent.MustReg(h.cReg).Logger().WithField("remote", r.RemoteAddr)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	var user *auth2.User
+	if token := requestToken(r); len(token) > 0 {
+		var err error
+		user, err = h.inspect(r.Context(), token)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	lastEventId := r.Header.Get("Last-Event-ID")
+	if len(lastEventId) < 1 {
+		lastEventId = r.URL.Query().Get("last_event_id")
+	}
+	since, err := strconv.ParseUint(lastEventId, 10, 64)
+	if err != nil {
+		since = 0
+	}
+
+	// Subscribe before the snapshot, events which arrive meanwhile wait in the queue
+	s := newSubscription(nil)
+	last, missed, resumed := h.feed.subscribe(s, since)
+	defer h.feed.unsubscribe(s)
+	defer s.close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	// Disable response buffering in nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	if resumed {
+		for _, ev := range missed {
+			if err := writeSSEGameEvent(w, user, ev); err != nil {
+				logger.Debug(err)
+				return
+			}
+		}
+	} else {
+		games, err := h.snapshot(r.Context())
+		if err != nil {
+			logger.Error(err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		// Same shape as the List route
+		snapshot := &gamedbpb.ListResponse{}
+		for _, g := range games {
+			if vg := view(user, g); vg != nil {
+				snapshot.Games = append(snapshot.Games, vg)
+			}
+		}
+		snapshot.Count = uint64(len(snapshot.Games))
+
+		data, err := marshaler.Marshal(snapshot)
+		if err != nil {
+			logger.Error(err)
+			return
+		}
+		if err := writeSSE(w, last, MessageSnapshot, data); err != nil {
+			logger.Debug(err)
+			return
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		case ev := <-s.events:
+			if err := writeSSEGameEvent(w, user, ev); err != nil {
+				logger.Debug(err)
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
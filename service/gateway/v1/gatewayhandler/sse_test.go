@@ -0,0 +1,74 @@
+package gatewayhandler
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"jochum.dev/jo-micro/auth2"
+	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+)
+
+func TestSSEEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     *auth2.User
+		action   gamedbpb.GameEvent_Action
+		private  bool
+		want     string
+		redacted bool
+	}{
+		{"created", nil, gamedbpb.GameEvent_CREATED, false, MessageCreated, true},
+		{"updated", nil, gamedbpb.GameEvent_UPDATED, false, MessageUpdated, true},
+		{"deleted", nil, gamedbpb.GameEvent_DELETED, false, MessageDeleted, true},
+		{"private created", nil, gamedbpb.GameEvent_CREATED, true, "", false},
+		{"went private", other, gamedbpb.GameEvent_UPDATED, true, MessageDeleted, true},
+		{"private deleted", nil, gamedbpb.GameEvent_DELETED, true, MessageDeleted, true},
+		{"player private", player, gamedbpb.GameEvent_UPDATED, true, MessageUpdated, false},
+		{"admin private", admin, gamedbpb.GameEvent_CREATED, true, MessageCreated, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, g := sseEvent(tt.user, &gamedbpb.GameEvent{Action: tt.action, Game: testGame("a", tt.private)})
+			if event != tt.want {
+				t.Errorf("event = %q, want %q", event, tt.want)
+			}
+			if g == nil {
+				if len(tt.want) > 0 {
+					t.Error("no game")
+				}
+				return
+			}
+
+			if g.Id != "a" {
+				t.Errorf("game id = %q, want a", g.Id)
+			}
+			if redacted := len(g.HostIp) == 0; redacted != tt.redacted {
+				t.Errorf("redacted = %v, want %v", redacted, tt.redacted)
+			}
+		})
+	}
+}
+
+func TestWriteSSE(t *testing.T) {
+	tests := []struct {
+		name string
+		id   uint64
+		want string
+	}{
+		{"with id", 7, "id: 7\nevent: updated\ndata: {}\n\n"},
+		{"without id", 0, "event: updated\ndata: {}\n\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			if err := writeSSE(w, tt.id, MessageUpdated, []byte("{}")); err != nil {
+				t.Fatal(err)
+			}
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("writeSSE wrote %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+// standin is a local IRC server for the irc bot, it prints what the bot sends and
+// forwards each line from stdin as a message of the user "tester" to the channel.
+//
+//	standin -listen :6667 -channel '#wz2100-test'
+//	!games
+//
+// Lines starting with "/raw " are sent as they are.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+type server struct {
+	channel string
+
+	lock sync.Mutex
+	conn net.Conn
+	nick string
+}
+
+func (s *server) send(format string, args ...interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.conn == nil {
+		log.Print("No bot connected")
+		return
+	}
+
+	line := fmt.Sprintf(format, args...)
+	fmt.Printf(">> %s\n", line)
+	fmt.Fprintf(s.conn, "%s\r\n", line)
+}
+
+func (s *server) serve(conn net.Conn) {
+	s.lock.Lock()
+	s.conn = conn
+	s.lock.Unlock()
+
+	defer func() {
+		s.lock.Lock()
+		s.conn = nil
+		s.lock.Unlock()
+
+		conn.Close()
+		log.Print("Bot disconnected")
+	}()
+
+	reader := bufio.NewScanner(conn)
+	for reader.Scan() {
+		line := reader.Text()
+		fmt.Printf("<< %s\n", line)
+
+		fields := strings.Fields(line)
+		if len(fields) < 1 {
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "NICK":
+			if len(fields) > 1 {
+				s.lock.Lock()
+				s.nick = fields[1]
+				s.lock.Unlock()
+			}
+		case "USER":
+			s.send(":standin 001 %s :Welcome to the standin", s.nick)
+		case "JOIN":
+			if len(fields) > 1 {
+				s.send(":%s!bot@localhost JOIN %s", s.nick, fields[1])
+			}
+		case "PING":
+			s.send(":standin PONG standin %s", strings.Join(fields[1:], " "))
+		case "QUIT":
+			return
+		}
+	}
+}
+
+func main() {
+	listen := flag.String("listen", ":6667", "Address to listen on")
+	channel := flag.String("channel", "#wz2100-test", "Channel the lines from stdin go to")
+	flag.Parse()
+
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Listening on %s, type commands for %s", *listen, *channel)
+
+	s := &server{channel: *channel}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				log.Fatal(err)
+			}
+			s.serve(conn)
+		}
+	}()
+
+	stdin := bufio.NewScanner(os.Stdin)
+	for stdin.Scan() {
+		line := stdin.Text()
+		if strings.HasPrefix(line, "/raw ") {
+			s.send("%s", strings.TrimPrefix(line, "/raw "))
+			continue
+		}
+
+		s.send(":tester!tester@localhost PRIVMSG %s :%s", s.channel, line)
+	}
+}
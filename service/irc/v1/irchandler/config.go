@@ -0,0 +1,75 @@
+package irchandler
+
+import (
+	"context"
+
+	"wz2100.net/microlobby/service/settings"
+)
+
+// configName is the name of the setting which holds the Config
+const configName = "config"
+
+// Events the bot can announce, see docs/events.md
+const (
+	EventGameCreated = "game.created"
+	EventGameDeleted = "game.deleted"
+)
+
+type Config struct {
+	// Server is host:port of the IRC network, empty disables the bot
+	Server   string `json:"server"`
+	TLS      bool   `json:"tls"`
+	Password string `json:"password"`
+
+	Nick     string `json:"nick"`
+	User     string `json:"user"`
+	RealName string `json:"real_name"`
+	// NickServPassword identifies the nick after connecting
+	NickServPassword string `json:"nickserv_password"`
+
+	Channels []string `json:"channels"`
+	// Announce are the events which get posted to all channels
+	Announce []string `json:"announce"`
+
+	// CommandPrefix starts commands, "!" gives "!games"
+	CommandPrefix string `json:"command_prefix"`
+	// MaxGames is the number of games "!games" lists, the rest is a count, 0 lists all
+	MaxGames int `json:"max_games"`
+	// CommandCooldown is the time in seconds a nick and a channel wait between commands, others get ignored
+	CommandCooldown int `json:"command_cooldown"`
+
+	// ReconnectDelay is the time in seconds to wait before connecting again
+	ReconnectDelay int `json:"reconnect_delay"`
+}
+
+func (c *Config) announces(event string) bool {
+	for _, e := range c.Announce {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+func defaultConfig() Config {
+	return Config{
+		Server:          "",
+		TLS:             true,
+		Nick:            "wz2100lobby",
+		User:            "microlobby",
+		RealName:        "Warzone 2100 Lobby",
+		Channels:        []string{},
+		Announce:        []string{EventGameCreated},
+		CommandPrefix:   "!",
+		MaxGames:        5,
+		CommandCooldown: 5,
+		ReconnectDelay:  30,
+	}
+}
+
+func (h *Handler) loadConfig(ctx context.Context) (Config, error) {
+	c := defaultConfig()
+	err := settings.MustReg(h.cReg).LoadJSON(ctx, h.cReg.Service().Name(), configName, &c)
+	return c, err
+}
@@ -0,0 +1,56 @@
+package irchandler
+
+import (
+	"fmt"
+	"strings"
+
+	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+)
+
+// shortIdLength is enough to tell the games in a lobby apart
+const shortIdLength = 8
+
+func shortId(id string) string {
+	if len(id) > shortIdLength {
+		return id[:shortIdLength]
+	}
+
+	return id
+}
+
+func formatGame(g *gamedbpb.Game) string {
+	return fmt.Sprintf("\"%s\" on %s (%d/%d players, %s)", g.Description, g.Map, len(g.Players), g.MaxPlayers, g.Version)
+}
+
+func formatGameDetails(g *gamedbpb.Game) string {
+	names := []string{}
+	for _, p := range g.Players {
+		names = append(names, p.Name)
+	}
+
+	lines := []string{
+		fmt.Sprintf("[%s] %s", g.Id, formatGame(g)),
+		"Players: " + strings.Join(names, ", "),
+	}
+	if len(g.Mods) > 0 {
+		lines = append(lines, "Mods: "+strings.Join(g.Mods, ", "))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// findGame finds a game by its id or the start of it, like the short id from "!games"
+func findGame(games []*gamedbpb.Game, id string) *gamedbpb.Game {
+	id = strings.ToLower(id)
+	if len(id) < 4 {
+		return nil
+	}
+
+	for _, g := range games {
+		if strings.HasPrefix(g.Id, id) {
+			return g
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,532 @@
+package irchandler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"go-micro.dev/v4"
+	"go-micro.dev/v4/errors"
+	"go-micro.dev/v4/server"
+	"jochum.dev/jo-micro/auth2"
+	"jochum.dev/jo-micro/components"
+	"jochum.dev/jo-micro/logruscomponent"
+	gamedbConfig "wz2100.net/microlobby/service/gamedb/v1/config"
+	"wz2100.net/microlobby/service/irc/v1/config"
+	"wz2100.net/microlobby/service/settings"
+	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+	"wz2100.net/microlobby/shared/utils"
+)
+
+const (
+	Name = "ircHandler"
+
+	dialTimeout = 30 * time.Second
+	// readTimeout is longer than the PING interval of all networks we know
+	readTimeout = 5 * time.Minute
+
+	// commandQueue is the number of commands waiting for an answer, more get dropped
+	commandQueue = 16
+	// cooldownKeys is the number of nicks and channels the cooldown remembers before it forgets the idle ones
+	cooldownKeys = 1024
+	// gamesCacheTTL is how long the commands reuse a game list
+	gamesCacheTTL = 5 * time.Second
+)
+
+type Handler struct {
+	cReg        *components.Registry
+	initialized bool
+
+	// lock guards config and conn
+	lock   sync.Mutex
+	config Config
+	conn   *conn
+
+	// restart makes run connect again with the current config
+	restart chan struct{}
+	stop    chan struct{}
+
+	// gamesLock guards games and gamesAt, the commands share a list for gamesCacheTTL
+	gamesLock sync.Mutex
+	games     []*gamedbpb.Game
+	gamesAt   time.Time
+}
+
+// privmsg is a PRIVMSG for the command worker, nick is ours when it came in
+type privmsg struct {
+	nick string
+	m    *message
+}
+
+// cooldown remembers when nicks and channels ran their last command, only the command worker uses it
+type cooldown struct {
+	d    time.Duration
+	last map[string]time.Time
+}
+
+func newCooldown(d time.Duration) *cooldown {
+	return &cooldown{d: d, last: make(map[string]time.Time)}
+}
+
+// allow reports whether all keys waited long enough, if so they have to wait again from now
+func (c *cooldown) allow(now time.Time, keys ...string) bool {
+	for _, k := range keys {
+		if last, ok := c.last[k]; ok && now.Sub(last) < c.d {
+			return false
+		}
+	}
+
+	// Don't remember every nick we ever saw
+	if len(c.last) >= cooldownKeys {
+		for k, last := range c.last {
+			if now.Sub(last) >= c.d {
+				delete(c.last, k)
+			}
+		}
+	}
+
+	for _, k := range keys {
+		c.last[k] = now
+	}
+	return true
+}
+
+func New() *Handler {
+	return &Handler{
+		initialized: false,
+		config:      defaultConfig(),
+		restart:     make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+	}
+}
+
+func MustReg(cReg *components.Registry) *Handler {
+	return cReg.Must(Name).(*Handler)
+}
+
+func (h *Handler) Name() string {
+	return Name
+}
+
+func (h *Handler) Priority() int {
+	return 100
+}
+
+func (h *Handler) Initialized() bool {
+	return h.initialized
+}
+
+func (h *Handler) Init(components *components.Registry, cli *cli.Context) error {
+	if h.initialized {
+		return nil
+	}
+
+	h.cReg = components
+	s := h.cReg.Service().Server()
+
+	// Queued, only one bot announces an event
+	queue := server.SubscriberQueue(config.Name)
+	if err := micro.RegisterSubscriber(gamedbConfig.TopicGameCreated, s, h.onGameCreated, queue); err != nil {
+		return errors.FromError(err)
+	}
+	if err := micro.RegisterSubscriber(gamedbConfig.TopicGameDeleted, s, h.onGameDeleted, queue); err != nil {
+		return errors.FromError(err)
+	}
+
+	settings.MustReg(h.cReg).Watch(h.cReg.Service().Name(), configName, func(ctx context.Context) {
+		h.reload()
+	})
+	h.reload()
+
+	go h.run()
+
+	h.initialized = true
+	return nil
+}
+
+func (h *Handler) Stop() error {
+	h.lock.Lock()
+	if h.conn != nil {
+		h.conn.send("QUIT :Shutting down")
+	}
+	h.lock.Unlock()
+
+	// Give the QUIT a moment, closing stop closes the connection
+	time.Sleep(sendInterval)
+	close(h.stop)
+
+	return nil
+}
+
+func (h *Handler) Flags(r *components.Registry) []cli.Flag {
+	return []cli.Flag{}
+}
+
+func (h *Handler) Health(context context.Context) error {
+	return nil
+}
+
+func (h *Handler) getConfig() Config {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.config
+}
+
+// reload loads the config and reconnects with it
+func (h *Handler) reload() {
+	logger := logruscomponent.MustReg(h.cReg).Logger()
+
+	ctx, err := auth2.ClientAuthMustReg(h.cReg).Plugin().ServiceContext(context.Background())
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	c, err := h.loadConfig(ctx)
+	if err != nil {
+		logger.WithField("setting", configName).Error("Failed to reload the config: ", err)
+		return
+	}
+
+	h.lock.Lock()
+	h.config = c
+	h.lock.Unlock()
+
+	select {
+	case h.restart <- struct{}{}:
+	default:
+	}
+
+	logger.Info("Reloaded the config")
+}
+
+// wait waits for d, a restart or Stop, it returns false on Stop
+func (h *Handler) wait(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-h.stop:
+		return false
+	case <-h.restart:
+	case <-t.C:
+	}
+
+	return true
+}
+
+// run keeps the bot connected until Stop
+func (h *Handler) run() {
+	logger := logruscomponent.MustReg(h.cReg).Logger().WithField("component", Name)
+
+	// Init loaded the config already
+	select {
+	case <-h.restart:
+	default:
+	}
+
+	for {
+		c := h.getConfig()
+		if len(c.Server) < 1 {
+			logger.Info("No IRC server configured")
+			// Wait for a config
+			select {
+			case <-h.stop:
+				return
+			case <-h.restart:
+			}
+			continue
+		}
+
+		ic, err := dial(c.Server, c.TLS, dialTimeout)
+		if err == nil {
+			logger.WithField("server", c.Server).Info("Connected")
+			err = h.session(c, ic)
+		}
+
+		select {
+		case <-h.stop:
+			return
+		default:
+		}
+
+		// No error means a new config, connect with it at once
+		if err == nil {
+			continue
+		}
+
+		logger.WithField("server", c.Server).Error("Disconnected: ", err)
+		if !h.wait(time.Duration(c.ReconnectDelay) * time.Second) {
+			return
+		}
+	}
+}
+
+// session registers with the server and handles its messages until the connection is gone
+func (h *Handler) session(c Config, ic *conn) error {
+	defer ic.close()
+
+	// Reconnect on a new config
+	go func() {
+		select {
+		case <-h.restart:
+			ic.send("QUIT :Reconnecting")
+			time.Sleep(sendInterval)
+		case <-h.stop:
+		case <-ic.done:
+		}
+		ic.close()
+	}()
+
+	// One worker answers the commands, they call gamedb and must not block PINGs
+	cmds := make(chan privmsg, commandQueue)
+	defer close(cmds)
+	go h.commands(c, ic, cmds)
+
+	if len(c.Password) > 0 {
+		ic.send("PASS %s", c.Password)
+	}
+	nick := c.Nick
+	ic.send("NICK %s", nick)
+	ic.send("USER %s 0 * :%s", c.User, c.RealName)
+
+	for {
+		m, err := ic.read(readTimeout)
+		if err != nil {
+			select {
+			case <-ic.done:
+				// We closed it
+				return nil
+			default:
+				return err
+			}
+		}
+
+		switch m.Command {
+		case "PING":
+			ic.send("PONG :%s", m.Param(0))
+		case "001":
+			// Welcome, we are registered
+			if len(c.NickServPassword) > 0 {
+				ic.privmsg("NickServ", "IDENTIFY "+c.NickServPassword)
+			}
+			for _, channel := range c.Channels {
+				ic.send("JOIN %s", channel)
+			}
+
+			h.lock.Lock()
+			h.conn = ic
+			h.lock.Unlock()
+			defer func() {
+				h.lock.Lock()
+				if h.conn == ic {
+					h.conn = nil
+				}
+				h.lock.Unlock()
+			}()
+		case "433":
+			// Nick in use
+			nick += "_"
+			ic.send("NICK %s", nick)
+		case "PRIVMSG":
+			select {
+			case cmds <- privmsg{nick: nick, m: m}:
+			default:
+				// Flooded, the worker is busy with enough of them
+			}
+		case "ERROR":
+			return fmt.Errorf("server error: %s", m.Param(0))
+		}
+	}
+}
+
+// commands answers the PRIVMSGs of cmds until the session closes it
+func (h *Handler) commands(c Config, ic *conn, cmds <-chan privmsg) {
+	cd := newCooldown(time.Duration(c.CommandCooldown) * time.Second)
+	for pm := range cmds {
+		h.onPrivmsg(c, ic, cd, pm.nick, pm.m)
+	}
+}
+
+func (h *Handler) onPrivmsg(c Config, ic *conn, cd *cooldown, nick string, m *message) {
+	text := strings.TrimSpace(m.Param(1))
+	if !strings.HasPrefix(text, c.CommandPrefix) {
+		return
+	}
+
+	// Answer in the channel or privately
+	target := m.Param(0)
+	if strings.EqualFold(target, nick) {
+		target = m.Nick()
+	}
+
+	// A nick can't flood a channel and many nicks can't either
+	if !cd.allow(time.Now(), "nick:"+strings.ToLower(m.Nick()), strings.ToLower(target)) {
+		return
+	}
+
+	reply := h.command(c, strings.Fields(strings.TrimPrefix(text, c.CommandPrefix)))
+	if len(reply) > 0 {
+		ic.privmsg(target, reply)
+	}
+}
+
+// command runs a command and returns the reply
+func (h *Handler) command(c Config, args []string) string {
+	if len(args) < 1 {
+		return ""
+	}
+
+	logger := logruscomponent.MustReg(h.cReg).Logger().WithField("component", Name)
+
+	switch strings.ToLower(args[0]) {
+	case "games":
+		games, err := h.listGames()
+		if err != nil {
+			logger.Error(err)
+			return "Sorry, I can't reach the lobby right now"
+		}
+		if len(games) == 0 {
+			return "No games hosted right now"
+		}
+
+		lines := []string{}
+		for i, g := range games {
+			if c.MaxGames > 0 && i == c.MaxGames {
+				lines = append(lines, fmt.Sprintf("... and %d more", len(games)-c.MaxGames))
+				break
+			}
+			lines = append(lines, fmt.Sprintf("[%s] %s", shortId(g.Id), formatGame(g)))
+		}
+		return strings.Join(lines, "\n")
+	case "game":
+		if len(args) < 2 {
+			return fmt.Sprintf("Usage: %sgame <id>", c.CommandPrefix)
+		}
+
+		games, err := h.listGames()
+		if err != nil {
+			logger.Error(err)
+			return "Sorry, I can't reach the lobby right now"
+		}
+
+		g := findGame(games, args[1])
+		if g == nil {
+			return fmt.Sprintf("No game with the id %s", args[1])
+		}
+
+		return formatGameDetails(g)
+	case "motd":
+		text, err := h.motd()
+		if err != nil {
+			logger.Error(err)
+			return "Sorry, I can't reach the lobby right now"
+		}
+		return text
+	case "help":
+		return fmt.Sprintf("Commands: %[1]sgames, %[1]sgame <id>, %[1]smotd", c.CommandPrefix)
+	}
+
+	return ""
+}
+
+func (h *Handler) gameDBClient() (gamedbpb.GameDBV1Service, error) {
+	// Wait until the service is here
+	_, err := utils.ServiceRetryGet(h.cReg.Service(), gamedbConfig.Name, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	return gamedbpb.NewGameDBV1Service(gamedbConfig.Name, h.cReg.Service().Client()), nil
+}
+
+// listGames returns the public games, callers must not modify them
+func (h *Handler) listGames() ([]*gamedbpb.Game, error) {
+	h.gamesLock.Lock()
+	defer h.gamesLock.Unlock()
+
+	if h.games != nil && time.Since(h.gamesAt) < gamesCacheTTL {
+		return h.games, nil
+	}
+
+	ctx, err := auth2.ClientAuthMustReg(h.cReg).Plugin().ServiceContext(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	gamedb, err := h.gameDBClient()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := gamedb.List(ctx, &gamedbpb.ListRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	games := []*gamedbpb.Game{}
+	for _, g := range result.Games {
+		if !g.IsPrivate {
+			games = append(games, g)
+		}
+	}
+
+	h.games = games
+	h.gamesAt = time.Now()
+	return games, nil
+}
+
+func (h *Handler) motd() (string, error) {
+	ctx, err := auth2.ClientAuthMustReg(h.cReg).Plugin().ServiceContext(context.Background())
+	if err != nil {
+		return "", err
+	}
+
+	gamedb, err := h.gameDBClient()
+	if err != nil {
+		return "", err
+	}
+
+	result, err := gamedb.Motd(ctx, &gamedbpb.MotdRequest{})
+	if err != nil {
+		return "", err
+	}
+
+	return result.Text, nil
+}
+
+// announce posts text to all channels, it does nothing while the bot is disconnected
+func (h *Handler) announce(event string, text string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.conn == nil || !h.config.announces(event) {
+		return
+	}
+
+	for _, channel := range h.config.Channels {
+		h.conn.privmsg(channel, text)
+	}
+}
+
+func (h *Handler) onGameCreated(ctx context.Context, ev *gamedbpb.GameCreated) error {
+	if ev.Meta.GetSchemaVersion() != gamedbConfig.EventSchemaVersion || ev.Game.IsPrivate {
+		return nil
+	}
+
+	h.announce(EventGameCreated, fmt.Sprintf("New game [%s] %s", shortId(ev.Game.Id), formatGame(ev.Game)))
+	return nil
+}
+
+func (h *Handler) onGameDeleted(ctx context.Context, ev *gamedbpb.GameDeleted) error {
+	if ev.Meta.GetSchemaVersion() != gamedbConfig.EventSchemaVersion || ev.Game.IsPrivate || len(ev.Game.Description) < 1 {
+		return nil
+	}
+
+	h.announce(EventGameDeleted, fmt.Sprintf("Game [%s] \"%s\" is gone", shortId(ev.Game.Id), ev.Game.Description))
+	return nil
+}
@@ -0,0 +1,189 @@
+package irchandler
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxLineLength leaves room for the prefix the server adds, lines are 512 bytes with CRLF
+	maxLineLength = 400
+	// sendInterval keeps us below the flood limit of most networks
+	sendInterval = 500 * time.Millisecond
+)
+
+// message is a parsed IRC line
+type message struct {
+	Prefix  string
+	Command string
+	Params  []string
+}
+
+// Nick returns the nick of the prefix "nick!user@host"
+func (m *message) Nick() string {
+	nick, _, _ := strings.Cut(m.Prefix, "!")
+	return nick
+}
+
+// Param returns the param i or "" when there are less
+func (m *message) Param(i int) string {
+	if i < len(m.Params) {
+		return m.Params[i]
+	}
+
+	return ""
+}
+
+func parseMessage(line string) *message {
+	line = strings.TrimRight(line, "\r\n")
+	m := &message{}
+
+	// Tags aren't requested but some servers send them anyway
+	if strings.HasPrefix(line, "@") {
+		_, line, _ = strings.Cut(line, " ")
+	}
+
+	if strings.HasPrefix(line, ":") {
+		m.Prefix, line, _ = strings.Cut(line[1:], " ")
+	}
+
+	for len(line) > 0 {
+		if strings.HasPrefix(line, ":") {
+			m.Params = append(m.Params, line[1:])
+			break
+		}
+
+		var param string
+		param, line, _ = strings.Cut(line, " ")
+		if len(m.Command) < 1 {
+			m.Command = strings.ToUpper(param)
+		} else if len(param) > 0 {
+			m.Params = append(m.Params, param)
+		}
+	}
+
+	return m
+}
+
+// sanitize removes what could end a line or break it, texts come from game hosts
+func sanitize(in string) string {
+	in = strings.Map(func(r rune) rune {
+		switch r {
+		case '\r', '\n', '\x00':
+			return ' '
+		}
+		return r
+	}, in)
+
+	if len(in) > maxLineLength {
+		in = strings.ToValidUTF8(in[:maxLineLength], "")
+	}
+
+	return in
+}
+
+// conn is a connection to an IRC server, writes get queued and sent with sendInterval
+type conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	queue     chan string
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func dial(addr string, useTLS bool, timeout time.Duration) (*conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var nc net.Conn
+	var err error
+	if useTLS {
+		host, _, _ := net.SplitHostPort(addr)
+		nc, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: host})
+	} else {
+		nc, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &conn{
+		conn:   nc,
+		reader: bufio.NewReader(nc),
+		queue:  make(chan string, 64),
+		done:   make(chan struct{}),
+	}
+	go c.writeLoop()
+
+	return c, nil
+}
+
+func (c *conn) writeLoop() {
+	defer c.close()
+
+	ticker := time.NewTicker(sendInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case line := <-c.queue:
+			if err := c.conn.SetWriteDeadline(time.Now().Add(30 * time.Second)); err != nil {
+				return
+			}
+			if _, err := c.conn.Write([]byte(line + "\r\n")); err != nil {
+				return
+			}
+
+			select {
+			case <-c.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
+
+// send queues a line, it drops lines when the server doesn't take them fast enough
+func (c *conn) send(format string, args ...interface{}) {
+	select {
+	case c.queue <- sanitize(fmt.Sprintf(format, args...)):
+	case <-c.done:
+	default:
+	}
+}
+
+// privmsg sends text to target, each line on its own
+func (c *conn) privmsg(target, text string) {
+	for _, line := range strings.Split(text, "\n") {
+		if len(line) > 0 {
+			c.send("PRIVMSG %s :%s", target, line)
+		}
+	}
+}
+
+func (c *conn) read(timeout time.Duration) (*message, error) {
+	if err := c.conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	return parseMessage(line), nil
+}
+
+func (c *conn) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
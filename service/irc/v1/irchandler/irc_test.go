@@ -0,0 +1,104 @@
+package irchandler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMessage(t *testing.T) {
+	tests := []struct {
+		line string
+		want message
+	}{
+		{"PING :irc.example.org\r\n", message{Command: "PING", Params: []string{"irc.example.org"}}},
+		{":nick!user@host PRIVMSG #wz :!games now", message{Prefix: "nick!user@host", Command: "PRIVMSG", Params: []string{"#wz", "!games now"}}},
+		{"@time=2022-10-18T12:00:00Z :srv 001 bot :Welcome", message{Prefix: "srv", Command: "001", Params: []string{"bot", "Welcome"}}},
+		{"privmsg  bot  :hi", message{Command: "PRIVMSG", Params: []string{"bot", "hi"}}},
+		{":srv 433 * bot :Nickname is already in use", message{Prefix: "srv", Command: "433", Params: []string{"*", "bot", "Nickname is already in use"}}},
+		{"", message{}},
+	}
+
+	for _, tt := range tests {
+		if got := parseMessage(tt.line); !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("parseMessage(%q) = %+v, want %+v", tt.line, *got, tt.want)
+		}
+	}
+}
+
+func TestMessageNick(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{"nick!user@host", "nick"},
+		{"irc.example.org", "irc.example.org"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		m := &message{Prefix: tt.prefix}
+		if got := m.Nick(); got != tt.want {
+			t.Errorf("Nick of %q = %q, want %q", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain", "plain"},
+		{"a\r\nQUIT :bye", "a  QUIT :bye"},
+		{"nul\x00", "nul "},
+		{strings.Repeat("a", maxLineLength+10), strings.Repeat("a", maxLineLength)},
+		{strings.Repeat("a", maxLineLength-1) + "ü", strings.Repeat("a", maxLineLength-1)},
+	}
+
+	for _, tt := range tests {
+		if got := sanitize(tt.in); got != tt.want {
+			t.Errorf("sanitize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCooldown(t *testing.T) {
+	now := time.Now()
+	cd := newCooldown(5 * time.Second)
+
+	steps := []struct {
+		after time.Duration
+		keys  []string
+		want  bool
+	}{
+		{0, []string{"nick:a", "#wz"}, true},
+		{time.Second, []string{"nick:a", "#wz"}, false},
+		{time.Second, []string{"nick:b", "#wz"}, false},
+		{time.Second, []string{"nick:b", "#other"}, true},
+		// A denied command doesn't restart the wait
+		{5 * time.Second, []string{"nick:a", "#wz"}, true},
+		{5 * time.Second, []string{"nick:a", "#wz"}, false},
+	}
+
+	for i, s := range steps {
+		if got := cd.allow(now.Add(s.after), s.keys...); got != s.want {
+			t.Errorf("step %d: allow(%v) = %v, want %v", i, s.keys, got, s.want)
+		}
+	}
+}
+
+func TestCooldownForgets(t *testing.T) {
+	now := time.Now()
+	cd := newCooldown(time.Second)
+
+	for i := 0; i < cooldownKeys; i++ {
+		cd.allow(now, strings.Repeat("n", i+1))
+	}
+	cd.allow(now.Add(time.Second), "new")
+
+	if len(cd.last) != 1 {
+		t.Errorf("the cooldown remembers %d keys, want 1", len(cd.last))
+	}
+}
@@ -0,0 +1,164 @@
+// Package capture records lobby v3 sessions to JSON lines files and reads them back for replays.
+//
+// The first line of a capture is a Header, each following line is a Frame.
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Version of the capture format
+const Version = 1
+
+type Direction string
+
+const (
+	// In is data the client sent
+	In Direction = "in"
+	// Out is data the lobby sent
+	Out Direction = "out"
+)
+
+type Header struct {
+	Version int       `json:"version"`
+	Remote  string    `json:"remote"`
+	Started time.Time `json:"started"`
+}
+
+// Frame is the data of a single Read or Write, Data is base64 encoded in the file.
+type Frame struct {
+	Time      time.Time `json:"time"`
+	Direction Direction `json:"dir"`
+	Data      []byte    `json:"data"`
+}
+
+type Writer struct {
+	lock sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// Create starts a new capture for remote in dir.
+func Create(dir, remote string) (*Writer, error) {
+	now := time.Now()
+
+	// Keep the name portable, IPv6 addresses contain ":"
+	safeRemote := strings.NewReplacer(":", "_", "[", "", "]", "").Replace(remote)
+	name := filepath.Join(dir, fmt.Sprintf("%s-%s.jsonl", now.UTC().Format("20060102T150405.000000000"), safeRemote))
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Writer{file: f, enc: json.NewEncoder(f)}
+	if err := w.enc.Encode(&Header{Version: Version, Remote: remote, Started: now}); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Name returns the file name of the capture.
+func (w *Writer) Name() string {
+	return w.file.Name()
+}
+
+func (w *Writer) Write(dir Direction, data []byte) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.enc.Encode(&Frame{Time: time.Now(), Direction: dir, Data: data})
+}
+
+func (w *Writer) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.file.Close()
+}
+
+// Read reads a whole capture.
+func Read(r io.Reader) (*Header, []*Frame, error) {
+	scanner := bufio.NewScanner(r)
+	// A frame holds at most one read buffer, base64 makes it larger
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+
+	header := &Header{}
+	if err := json.Unmarshal(scanner.Bytes(), header); err != nil {
+		return nil, nil, err
+	}
+	if header.Version != Version {
+		return nil, nil, fmt.Errorf("unsupported capture version: %d", header.Version)
+	}
+
+	frames := []*Frame{}
+	for scanner.Scan() {
+		f := &Frame{}
+		if err := json.Unmarshal(scanner.Bytes(), f); err != nil {
+			return nil, nil, err
+		}
+		frames = append(frames, f)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return header, frames, nil
+}
+
+// Conn records everything which gets read from and written to the embedded Conn.
+type Conn struct {
+	net.Conn
+	w *Writer
+}
+
+func NewConn(conn net.Conn, w *Writer) *Conn {
+	return &Conn{Conn: conn, w: w}
+}
+
+// Name returns the file name of the capture.
+func (c *Conn) Name() string {
+	return c.w.Name()
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		// Recording must never break a session
+		_ = c.w.Write(In, b[:n])
+	}
+	return n, err
+}
+
+func (c *Conn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		_ = c.w.Write(Out, b[:n])
+	}
+	return n, err
+}
+
+// Close closes the Conn and the capture.
+func (c *Conn) Close() error {
+	err := c.Conn.Close()
+	c.w.Close()
+	return err
+}
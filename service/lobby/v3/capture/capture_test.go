@@ -0,0 +1,83 @@
+package capture
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConnRoundtrip(t *testing.T) {
+	w, err := Create(t.TempDir(), "[2001:db8::1]:2100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := filepath.Base(w.Name()); strings.ContainsAny(name, ":[]") {
+		t.Errorf("file name %q isn't portable", name)
+	}
+
+	client, server := net.Pipe()
+	c := NewConn(server, w)
+	go func() {
+		client.Write([]byte("list"))
+		buf := make([]byte, 16)
+		client.Read(buf)
+		client.Close()
+	}()
+
+	buf := make([]byte, 16)
+	n, err := c.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Write(buf[:n]); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	f, err := os.Open(w.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	header, frames, err := Read(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Version != Version || header.Remote != "[2001:db8::1]:2100" {
+		t.Errorf("header = %+v", header)
+	}
+
+	want := []Frame{{Direction: In, Data: []byte("list")}, {Direction: Out, Data: []byte("list")}}
+	if len(frames) != len(want) {
+		t.Fatalf("%d frames, want %d", len(frames), len(want))
+	}
+	for i, f := range frames {
+		if f.Direction != want[i].Direction || !bytes.Equal(f.Data, want[i].Data) {
+			t.Errorf("frame %d = %s %q, want %s %q", i, f.Direction, f.Data, want[i].Direction, want[i].Data)
+		}
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"empty", ""},
+		{"no header", "not json\n"},
+		{"other version", `{"version":2}` + "\n"},
+		{"broken frame", `{"version":1}` + "\n" + `{"dir":` + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := Read(strings.NewReader(tt.in)); err == nil {
+				t.Error("Read didn't fail")
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+// replay sends the client side of lobby v3 captures to a lobby and diffs its answers with the recorded ones.
+// Game ids and the games of other hosts change with every run, they are left out of the diff.
+//
+//	replay -addr localhost:9990 capture1.jsonl capture2.jsonl
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"wz2100.net/microlobby/service/lobby/v3/capture"
+	"wz2100.net/microlobby/shared/gamestruct"
+)
+
+// maxMessage limits the status messages we read, the lobby sends a MOTD at most
+const maxMessage = 64 * 1024
+
+// command is what the client sent for one command, addg carries a game
+type command struct {
+	name     string
+	data     []byte
+	game     *gamestruct.Game
+	waitTime time.Duration
+}
+
+// commands splits what the client sent into commands, the lobby's answers stay in one stream.
+func commands(frames []*capture.Frame) ([]*command, []byte, error) {
+	in := []byte{}
+	out := []byte{}
+	// times[i] is when the byte in[i] was sent
+	times := []time.Time{}
+	for _, f := range frames {
+		switch f.Direction {
+		case capture.In:
+			in = append(in, f.Data...)
+			for range f.Data {
+				times = append(times, f.Time)
+			}
+		case capture.Out:
+			out = append(out, f.Data...)
+		}
+	}
+
+	result := []*command{}
+	var last time.Time
+	for offset := 0; offset+5 <= len(in); {
+		c := &command{name: strings.ToLower(string(bytes.Trim(in[offset:offset+5], "\x00")))}
+		if !last.IsZero() {
+			c.waitTime = times[offset].Sub(last)
+		}
+		last = times[offset]
+
+		size := 5
+		if c.name == "addg" {
+			size += gamestruct.Size
+			if offset+size > len(in) {
+				// The client left in the middle of it
+				break
+			}
+
+			c.game = &gamestruct.Game{}
+			if err := c.game.UnmarshalBinary(in[offset+5 : offset+size]); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		c.data = in[offset : offset+size]
+		result = append(result, c)
+		offset += size
+	}
+
+	return result, out, nil
+}
+
+// answer is the decoded answer of the lobby to a command
+type answer struct {
+	code    uint32
+	message string
+	games   []*gamestruct.Game
+	gameId  uint32
+}
+
+func readStatus(r io.Reader, a *answer) error {
+	var header struct {
+		Code   uint32
+		Length uint32
+	}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return err
+	}
+	if header.Length > maxMessage {
+		return fmt.Errorf("status message of %d bytes", header.Length)
+	}
+
+	message := make([]byte, header.Length)
+	if _, err := io.ReadFull(r, message); err != nil {
+		return err
+	}
+
+	a.code = header.Code
+	a.message = string(message)
+	return nil
+}
+
+// readAnswer reads exactly the answer to cmd from r, it's nil for commands the lobby doesn't answer.
+func readAnswer(r io.Reader, cmd string) (*answer, error) {
+	a := &answer{}
+	switch cmd {
+	case "list":
+		var count uint32
+		if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+			return nil, err
+		}
+		for i := uint32(0); i < count; i++ {
+			g, err := gamestruct.Read(r)
+			if err != nil {
+				return nil, err
+			}
+			a.games = append(a.games, g)
+		}
+
+		if err := readStatus(r, a); err != nil {
+			return nil, err
+		}
+
+		// The lobby server flags, the lobby never sends a second list
+		var flags uint32
+		if err := binary.Read(r, binary.BigEndian, &flags); err != nil {
+			return nil, err
+		}
+		if flags != 0 {
+			return nil, fmt.Errorf("unsupported lobby server flags: %d", flags)
+		}
+	case "gaid":
+		if err := binary.Read(r, binary.BigEndian, &a.gameId); err != nil {
+			return nil, err
+		}
+	case "addg":
+		if err := readStatus(r, a); err != nil {
+			return nil, err
+		}
+	default:
+		// The lobby closes the connection
+		return nil, nil
+	}
+
+	return a, nil
+}
+
+// stable returns the fields of g which are the same in every run, the lobby fills in
+// the hosts IP and gamedb picks the id.
+func stable(g *gamestruct.Game) gamestruct.Game {
+	result := *g
+	result.Host = ""
+	result.GameId = 0
+	return result
+}
+
+// diff returns what differs between the recorded and the live answer. Game ids are new
+// on every run, list only compares the games this session hosted.
+func diff(hosted map[string]struct{}, want, got *answer) []string {
+	result := []string{}
+	if want == nil || got == nil {
+		if (want == nil) != (got == nil) {
+			result = append(result, fmt.Sprintf("expected an answer %v, got one %v", want != nil, got != nil))
+		}
+		return result
+	}
+
+	if want.code != got.code || want.message != got.message {
+		result = append(result, fmt.Sprintf("expected status %d %q, got %d %q", want.code, want.message, got.code, got.message))
+	}
+
+	live := map[string]gamestruct.Game{}
+	for _, g := range got.games {
+		live[g.Name] = stable(g)
+	}
+	for _, g := range want.games {
+		if _, ok := hosted[g.Name]; !ok {
+			continue
+		}
+
+		lg, ok := live[g.Name]
+		if !ok {
+			result = append(result, fmt.Sprintf("game %q is missing", g.Name))
+			continue
+		}
+		if sg := stable(g); !reflect.DeepEqual(sg, lg) {
+			result = append(result, fmt.Sprintf("game %q:\n    expected %+v\n         got %+v", g.Name, sg, lg))
+		}
+	}
+
+	return result
+}
+
+func replay(addr, name string, timeout time.Duration, realtime bool) (int, int, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	header, frames, err := capture.Read(f)
+	if err != nil {
+		return 0, 0, err
+	}
+	fmt.Printf("%s: recorded from %s at %s\n", name, header.Remote, header.Started.Format(time.RFC3339))
+
+	cmds, out, err := commands(frames)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+
+	recorded := bytes.NewReader(out)
+	hosted := map[string]struct{}{}
+	failed := 0
+	for i, c := range cmds {
+		want, err := readAnswer(recorded, c.name)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			// The recording ends before the answer
+			return i, failed, nil
+		} else if err != nil {
+			return i, failed, fmt.Errorf("recorded answer %d: %w", i, err)
+		}
+
+		if realtime && c.waitTime > 0 {
+			time.Sleep(c.waitTime)
+		}
+
+		if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+			return i, failed, err
+		}
+		if _, err := conn.Write(c.data); err != nil {
+			return i, failed, err
+		}
+
+		var got *answer
+		if want != nil {
+			got, err = readAnswer(conn, c.name)
+			if err != nil {
+				// The rest of the stream can't be framed anymore
+				fmt.Printf("  command %d (%s): %s\n", i, c.name, err)
+				return i + 1, failed + 1, nil
+			}
+		}
+
+		if c.game != nil {
+			hosted[c.game.Name] = struct{}{}
+		}
+
+		if d := diff(hosted, want, got); len(d) > 0 {
+			failed++
+			fmt.Printf("  command %d (%s):\n    %s\n", i, c.name, strings.Join(d, "\n    "))
+		}
+	}
+
+	if recorded.Len() > 0 {
+		fmt.Printf("  %d recorded bytes after the last answer, like a restart notice\n", recorded.Len())
+	}
+
+	return len(cmds), failed, nil
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:9990", "Address of the lobby to replay against")
+	timeout := flag.Duration("timeout", 10*time.Second, "Time to wait for each answer")
+	realtime := flag.Bool("realtime", false, "Wait between commands like the client did")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] capture.jsonl...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	exitCode := 0
+	for _, name := range flag.Args() {
+		total, failed, err := replay(*addr, name, *timeout, *realtime)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+			exitCode = 1
+			continue
+		}
+
+		fmt.Printf("%s: %d/%d commands matched\n", name, total-failed, total)
+		if failed > 0 {
+			exitCode = 1
+		}
+	}
+
+	os.Exit(exitCode)
+}
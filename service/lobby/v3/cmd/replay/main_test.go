@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"wz2100.net/microlobby/service/lobby/v3/capture"
+	"wz2100.net/microlobby/shared/gamestruct"
+)
+
+const testTimeout = 5 * time.Second
+
+func status(buf *bytes.Buffer, code uint32, message string) {
+	binary.Write(buf, binary.BigEndian, code)
+	binary.Write(buf, binary.BigEndian, uint32(len(message)))
+	buf.WriteString(message)
+}
+
+func list(buf *bytes.Buffer, message string, games ...*gamestruct.Game) {
+	binary.Write(buf, binary.BigEndian, uint32(len(games)))
+	for _, g := range games {
+		data, _ := g.MarshalBinary()
+		buf.Write(data)
+	}
+	status(buf, 200, message)
+	binary.Write(buf, binary.BigEndian, uint32(0))
+}
+
+func cmd(name string) []byte {
+	return append([]byte(name), 0)
+}
+
+// fakeLobby answers like a lobby with other ids, another host IP and more games than recorded
+func fakeLobby(t *testing.T, motd string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var hosted *gamestruct.Game
+		for {
+			c := make([]byte, 5)
+			if _, err := io.ReadFull(conn, c); err != nil {
+				return
+			}
+
+			buf := &bytes.Buffer{}
+			switch string(c[:4]) {
+			case "gaid":
+				binary.Write(buf, binary.BigEndian, uint32(99))
+			case "addg":
+				if hosted, err = gamestruct.Read(conn); err != nil {
+					return
+				}
+				hosted.Host = "203.0.113.1"
+				hosted.GameId = 99
+				status(buf, 200, motd)
+			case "list":
+				list(buf, motd, &gamestruct.Game{Version: gamestruct.Version, Name: "someone else"}, hosted)
+			}
+			conn.Write(buf.Bytes())
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func writeCapture(t *testing.T) string {
+	w, err := capture.Create(t.TempDir(), "192.0.2.1:4000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	game := &gamestruct.Game{Version: gamestruct.Version, Name: "mine", MapName: "Sk-Rush", MaxPlayers: 4}
+	data, err := game.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorded := *game
+	recorded.Host = "192.0.2.1"
+	recorded.GameId = 7
+
+	gaid := &bytes.Buffer{}
+	binary.Write(gaid, binary.BigEndian, uint32(7))
+	addg := &bytes.Buffer{}
+	status(addg, 200, "Welcome")
+	listed := &bytes.Buffer{}
+	list(listed, "Welcome", &recorded)
+
+	frames := []struct {
+		dir  capture.Direction
+		data []byte
+	}{
+		{capture.In, cmd("gaid")},
+		{capture.Out, gaid.Bytes()},
+		// The game arrives in two reads
+		{capture.In, append(cmd("addg"), data[:100]...)},
+		{capture.In, data[100:]},
+		{capture.Out, addg.Bytes()},
+		{capture.In, cmd("list")},
+		{capture.Out, listed.Bytes()},
+	}
+	for _, f := range frames {
+		if err := w.Write(f.dir, f.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return w.Name()
+}
+
+func TestReplay(t *testing.T) {
+	total, failed, err := replay(fakeLobby(t, "Welcome"), writeCapture(t), testTimeout, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || failed != 0 {
+		t.Errorf("replay matched %d/%d commands, want 3/3", total-failed, total)
+	}
+}
+
+func TestReplayDiffers(t *testing.T) {
+	// The MOTD is in the answers to addg and list
+	total, failed, err := replay(fakeLobby(t, "Maintenance"), writeCapture(t), testTimeout, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || failed != 2 {
+		t.Errorf("replay matched %d/%d commands, want 1/3", total-failed, total)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	mine := &gamestruct.Game{Name: "mine", MapName: "Sk-Rush", Host: "192.0.2.1", GameId: 7}
+	other := &gamestruct.Game{Name: "other"}
+	moved := *mine
+	moved.MapName = "Sk-Startup"
+	rehosted := *mine
+	rehosted.Host = "203.0.113.1"
+	rehosted.GameId = 99
+
+	hosted := map[string]struct{}{"mine": {}}
+	tests := []struct {
+		name  string
+		want  *answer
+		got   *answer
+		diffs int
+	}{
+		{"same", &answer{code: 200, games: []*gamestruct.Game{mine}}, &answer{code: 200, games: []*gamestruct.Game{mine}}, 0},
+		{"new id and IP", &answer{games: []*gamestruct.Game{mine}}, &answer{games: []*gamestruct.Game{&rehosted}}, 0},
+		{"other games", &answer{games: []*gamestruct.Game{mine, other}}, &answer{games: []*gamestruct.Game{mine}}, 0},
+		{"game id", &answer{gameId: 7}, &answer{gameId: 99}, 0},
+		{"changed", &answer{games: []*gamestruct.Game{mine}}, &answer{games: []*gamestruct.Game{&moved}}, 1},
+		{"missing", &answer{games: []*gamestruct.Game{mine}}, &answer{}, 1},
+		{"status", &answer{code: 200}, &answer{code: 400}, 1},
+		{"no answer", &answer{}, nil, 1},
+		{"both closed", nil, nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diff(hosted, tt.want, tt.got); len(got) != tt.diffs {
+				t.Errorf("diff = %q, want %d differences", got, tt.diffs)
+			}
+		})
+	}
+}
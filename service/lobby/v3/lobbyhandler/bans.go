@@ -0,0 +1,330 @@
+package lobbyhandler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/google/uuid"
+	"go-micro.dev/v4/errors"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"jochum.dev/jo-micro/auth2"
+	"jochum.dev/jo-micro/logruscomponent"
+	"wz2100.net/microlobby/service/settings"
+	"wz2100.net/microlobby/shared/proto/lobbypb/v3"
+	"wz2100.net/microlobby/shared/proto/settingsservicepb/v1"
+)
+
+// bansName is the name of the setting which holds the ban list
+const bansName = "bans"
+
+// maxBanRetries limits how often changeBans starts over when other instances change the list
+const maxBanRetries = 5
+
+// bannedTimeout limits the time a banned client gets to read its ban reason
+const bannedTimeout = 10 * time.Second
+
+type Ban struct {
+	Id string `json:"id"`
+	// Network is an IP or a CIDR
+	Network string `json:"network"`
+	Reason  string `json:"reason"`
+
+	// ExpiresAt nil means forever
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	CreatedBy string     `json:"created_by"`
+}
+
+func (b *Ban) expired(now time.Time) bool {
+	return b.ExpiresAt != nil && !now.Before(*b.ExpiresAt)
+}
+
+func (b *Ban) message() string {
+	if len(b.Reason) < 1 {
+		return "You are banned from this lobby"
+	}
+
+	return fmt.Sprintf("You are banned from this lobby: %s", b.Reason)
+}
+
+func (b *Ban) toProto(out *lobbypb.Ban) {
+	out.Id = b.Id
+	out.Network = b.Network
+	out.Reason = b.Reason
+	out.CreatedAt = timestamppb.New(b.CreatedAt)
+	out.CreatedBy = b.CreatedBy
+	if b.ExpiresAt != nil {
+		out.ExpiresAt = timestamppb.New(*b.ExpiresAt)
+	}
+}
+
+// parseNetwork parses an IP or a CIDR, a single IP becomes a /32 or /128 network.
+func parseNetwork(in string) (*net.IPNet, error) {
+	if strings.Contains(in, "/") {
+		_, n, err := net.ParseCIDR(in)
+		return n, err
+	}
+
+	ip := net.ParseIP(in)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address: %s", in)
+	}
+
+	bits := 128
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		bits = 32
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// banList is a parsed ban list, it never changes once built.
+type banList struct {
+	bans []*Ban
+	nets []*net.IPNet
+}
+
+func newBanList(bans []*Ban) (*banList, []error) {
+	l := &banList{}
+	errs := []error{}
+	for _, b := range bans {
+		n, err := parseNetwork(b.Network)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ban %s: %w", b.Id, err))
+			continue
+		}
+
+		l.bans = append(l.bans, b)
+		l.nets = append(l.nets, n)
+	}
+
+	return l, errs
+}
+
+// match returns the first active ban for ip or nil.
+func (l *banList) match(ip string, now time.Time) *Ban {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return nil
+	}
+
+	for i, n := range l.nets {
+		if n.Contains(parsed) && !l.bans[i].expired(now) {
+			return l.bans[i]
+		}
+	}
+
+	return nil
+}
+
+// loadBans fetches the ban list from the settings service, it stores an empty one if there is none.
+func (h *Handler) loadBans(ctx context.Context) ([]*Ban, error) {
+	bans := []*Ban{}
+	err := settings.MustReg(h.cReg).LoadJSON(ctx, h.cReg.Service().Name(), bansName, &bans)
+	return bans, err
+}
+
+// changeBans applies change to the stored ban list and returns the new one. The write only succeeds
+// while nobody else changed the list, else it starts over with the list of the other writer.
+func (h *Handler) changeBans(ctx context.Context, change func(bans []*Ban) ([]*Ban, error)) ([]*Ban, error) {
+	for i := 0; i < maxBanRetries; i++ {
+		se, err := settings.MustReg(h.cReg).Get(ctx, "", "", h.cReg.Service().Name(), bansName)
+		if settings.IsNotFound(err) {
+			// Stores an empty list
+			if _, err := h.loadBans(ctx); err != nil {
+				return nil, err
+			}
+			continue
+		} else if err != nil {
+			return nil, errors.FromError(err)
+		}
+
+		bans := []*Ban{}
+		if err := json.Unmarshal(se.Content, &bans); err != nil {
+			return nil, errors.FromError(err)
+		}
+
+		bans, err = change(bans)
+		if err != nil {
+			return nil, err
+		}
+
+		braw, err := json.Marshal(bans)
+		if err != nil {
+			return nil, errors.FromError(err)
+		}
+
+		_, err = settings.MustReg(h.cReg).Update(ctx, &settingsservicepb.UpdateRequest{
+			Id:        se.Id,
+			Content:   braw,
+			IfContent: se.Content,
+		})
+		if settings.IsConflict(err) {
+			continue
+		} else if err != nil {
+			return nil, errors.FromError(err)
+		}
+
+		return bans, nil
+	}
+
+	return nil, errors.Conflict("CONFLICT", "The ban list changes too often, please try again")
+}
+
+// setBans swaps the ban list, entries which don't parse get logged and skipped.
+func (h *Handler) setBans(bans []*Ban) {
+	l, errs := newBanList(bans)
+	for _, err := range errs {
+		logruscomponent.MustReg(h.cReg).Logger().WithField("setting", bansName).Warn(err)
+	}
+
+	h.configLock.Lock()
+	h.bans = l
+	h.configLock.Unlock()
+}
+
+// getBans returns the current ban list, it may change anytime.
+func (h *Handler) getBans() *banList {
+	h.configLock.RLock()
+	defer h.configLock.RUnlock()
+
+	return h.bans
+}
+
+// reloadBans swaps the ban list, open connections are not checked again.
+func (h *Handler) reloadBans() {
+	logger := logruscomponent.MustReg(h.cReg).Logger()
+
+	ctx, err := auth2.ClientAuthMustReg(h.cReg).Plugin().ServiceContext(context.Background())
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	bans, err := h.loadBans(ctx)
+	if err != nil {
+		logger.WithField("setting", bansName).Error("Failed to reload the bans: ", err)
+		return
+	}
+
+	h.setBans(bans)
+	logger.Infof("Reloaded %d bans", len(bans))
+}
+
+// rejectBanned answers the commands of a banned client with an error status, the client shows its message.
+func rejectBanned(conn net.Conn, message string) error {
+	if err := conn.SetDeadline(time.Now().Add(bannedTimeout)); err != nil {
+		return err
+	}
+
+	for {
+		cmdBuf := make([]byte, 5)
+		if _, err := io.ReadFull(conn, cmdBuf); err != nil {
+			return err
+		}
+
+		cmd := strings.ToLower(byteToString(cmdBuf))
+		data, err := refusal(conn, cmd, statusError, message)
+		if err != nil {
+			return err
+		}
+		if _, err := conn.Write(data); err != nil {
+			return err
+		}
+
+		// The client sends addg after gaid and reads the status there
+		if cmd != "gaid" {
+			return nil
+		}
+	}
+}
+
+func (h *Handler) ListBans(ctx context.Context, in *empty.Empty, out *lobbypb.BanList) error {
+	bans, err := h.loadBans(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range bans {
+		pb := &lobbypb.Ban{}
+		b.toProto(pb)
+		out.Bans = append(out.Bans, pb)
+	}
+
+	return nil
+}
+
+// CreateBan and DeleteBan change the list of all instances, see changeBans.
+func (h *Handler) CreateBan(ctx context.Context, in *lobbypb.CreateBanRequest, out *lobbypb.Ban) error {
+	user, err := auth2.ClientAuthMustReg(h.cReg).Plugin().Inspect(ctx)
+	if err != nil {
+		return errors.FromError(err)
+	}
+
+	n, err := parseNetwork(in.Network)
+	if err != nil {
+		return errors.BadRequest("INVALID_NETWORK", "Network must be an IP address or a CIDR")
+	}
+
+	now := time.Now()
+	ban := &Ban{
+		Id:        uuid.New().String(),
+		Network:   n.String(),
+		Reason:    in.Reason,
+		CreatedAt: now,
+		CreatedBy: user.Id,
+	}
+	if ones, bits := n.Mask.Size(); ones == bits {
+		ban.Network = n.IP.String()
+	}
+	if in.Duration > 0 {
+		expiresAt := now.Add(time.Duration(in.Duration) * time.Second)
+		ban.ExpiresAt = &expiresAt
+	}
+
+	result, err := h.changeBans(ctx, func(bans []*Ban) ([]*Ban, error) {
+		// Drop expired bans while we are here
+		result := []*Ban{}
+		for _, b := range bans {
+			if !b.expired(now) {
+				result = append(result, b)
+			}
+		}
+		return append(result, ban), nil
+	})
+	if err != nil {
+		return err
+	}
+	h.setBans(result)
+
+	ban.toProto(out)
+	return nil
+}
+
+func (h *Handler) DeleteBan(ctx context.Context, in *lobbypb.DeleteBanRequest, out *empty.Empty) error {
+	result, err := h.changeBans(ctx, func(bans []*Ban) ([]*Ban, error) {
+		result := []*Ban{}
+		for _, b := range bans {
+			if b.Id != in.Id {
+				result = append(result, b)
+			}
+		}
+		if len(result) == len(bans) {
+			return nil, errors.NotFound("NOT_FOUND", "Ban not found")
+		}
+		return result, nil
+	})
+	if err != nil {
+		return err
+	}
+	h.setBans(result)
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package lobbyhandler
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseNetwork(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"192.0.2.1", "192.0.2.1/32"},
+		{"192.0.2.77/24", "192.0.2.0/24"},
+		{"2001:db8::1", "2001:db8::1/128"},
+		{"2001:db8::/32", "2001:db8::/32"},
+		{"::ffff:192.0.2.1", "192.0.2.1/32"},
+		{"nope", ""},
+		{"192.0.2.1/33", ""},
+	}
+
+	for _, tt := range tests {
+		n, err := parseNetwork(tt.in)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("parseNetwork(%q) = %v, want an error", tt.in, n)
+			}
+			continue
+		}
+		if err != nil || n.String() != tt.want {
+			t.Errorf("parseNetwork(%q) = %v, %v, want %s", tt.in, n, err, tt.want)
+		}
+	}
+}
+
+func TestBanListMatch(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Minute)
+
+	l, errs := newBanList([]*Ban{
+		{Id: "broken", Network: "nope"},
+		{Id: "expired", Network: "198.51.100.0/24", ExpiresAt: &past},
+		{Id: "single", Network: "192.0.2.1"},
+		{Id: "net", Network: "198.51.100.0/24", ExpiresAt: &future},
+		{Id: "v6", Network: "2001:db8::/32"},
+	})
+	if len(errs) != 1 {
+		t.Errorf("newBanList gave %d errors, want 1", len(errs))
+	}
+
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"192.0.2.1", "single"},
+		{"192.0.2.2", ""},
+		{"198.51.100.9", "net"},
+		{"2001:db8::42", "v6"},
+		{"2001:db9::42", ""},
+		{"invalid", ""},
+	}
+
+	for _, tt := range tests {
+		got := ""
+		if b := l.match(tt.ip, now); b != nil {
+			got = b.Id
+		}
+		if got != tt.want {
+			t.Errorf("match(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+
+	// The ban expires exactly at ExpiresAt
+	if b := l.match("198.51.100.9", future); b != nil {
+		t.Errorf("match at the expiry = %q, want none", b.Id)
+	}
+}
+
+func TestRejectBanned(t *testing.T) {
+	tests := []struct {
+		name    string
+		send    []byte
+		want    []byte
+		wantErr bool
+	}{
+		{"list", []byte("list\x00"), append(append([]byte{0, 0, 0, 0}, status(statusError, "banned")...), 0, 0, 0, 0), false},
+		{"gaid then a broken addg", []byte("gaid\x00addg\x00"), []byte{0, 0, 0, 0}, true},
+		{"unknown", []byte("join\x00"), []byte{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+
+			done := make(chan error, 1)
+			go func() {
+				done <- rejectBanned(server, "banned")
+				server.Close()
+			}()
+
+			go func() {
+				client.Write(tt.send)
+			}()
+			got := make([]byte, len(tt.want))
+			if _, err := io.ReadFull(client, got); err != nil {
+				t.Fatal(err)
+			}
+			// A half sent game ends here
+			client.Close()
+
+			if err := <-done; (err != nil) != tt.wantErr {
+				t.Errorf("rejectBanned = %v, want an error %v", err, tt.wantErr)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("rejectBanned wrote %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package lobbyhandler
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/pires/go-proxyproto"
+	"jochum.dev/jo-micro/auth2"
+	"jochum.dev/jo-micro/logruscomponent"
+	"wz2100.net/microlobby/service/settings"
+	"wz2100.net/microlobby/shared/motd"
+)
+
+// configName is the name of the setting which holds the Config
+const configName = "config"
+
+type Config struct {
+	Host string `json:"host"`
+	Port int32  `json:"port"`
+
+	// ProbeTimeout is the time in seconds to wait for a host to accept a connection, 0 disables the probe
+	ProbeTimeout int `json:"probe_timeout"`
+
+	// ProxyProtocol enables PROXY protocol v1/v2, the header is only used from TrustedProxies (IPs or CIDRs)
+	ProxyProtocol  bool     `json:"proxy_protocol"`
+	TrustedProxies []string `json:"trusted_proxies"`
+
+	// Concurrent connection limits, 0 means unlimited
+	MaxConnections      int `json:"max_connections"`
+	MaxConnectionsPerIP int `json:"max_connections_per_ip"`
+
+	// CommandTimeout is the time in seconds a client has to send a commands payload and to read the answer
+	CommandTimeout int `json:"command_timeout"`
+	// IdleTimeout is the time in seconds a client which doesn't host a game may wait before sending the next command
+	IdleTimeout int `json:"idle_timeout"`
+
+	// ShutdownGracePeriod is the time in seconds Stop waits for connections to finish before it closes them
+	ShutdownGracePeriod int `json:"shutdown_grace_period"`
+
+	// CaptureDir enables recording new sessions into this directory, empty disables it
+	CaptureDir string `json:"capture_dir"`
+
+	// RateLimits per remote IP and command ("list", "gaid", "addg"), commands without one are unlimited
+	RateLimits map[string]RateLimit `json:"rate_limits"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		Host:         "0.0.0.0",
+		Port:         9990,
+		ProbeTimeout: 5,
+
+		MaxConnections:      10000,
+		MaxConnectionsPerIP: 16,
+		CommandTimeout:      10,
+		IdleTimeout:         60,
+		ShutdownGracePeriod: 10,
+
+		RateLimits: map[string]RateLimit{
+			"list": {Rate: 1, Burst: 20},
+			"gaid": {Rate: 0.1, Burst: 5},
+			"addg": {Rate: 0.1, Burst: 5},
+		},
+	}
+}
+
+// needsListen reports whether switching from c to n requires a new listener
+func (c Config) needsListen(n Config) bool {
+	return c.Host != n.Host || c.Port != n.Port
+}
+
+// needsProxy reports whether switching from c to n changes the PROXY protocol policy
+func (c Config) needsProxy(n Config) bool {
+	if c.ProxyProtocol != n.ProxyProtocol || len(c.TrustedProxies) != len(n.TrustedProxies) {
+		return true
+	}
+	for i := range c.TrustedProxies {
+		if c.TrustedProxies[i] != n.TrustedProxies[i] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// loadConfig fetches the Config from the settings service, it stores the defaults if there is none.
+func (h *Handler) loadConfig(ctx context.Context) (Config, error) {
+	c := defaultConfig()
+	err := settings.MustReg(h.cReg).LoadJSON(ctx, h.cReg.Service().Name(), configName, &c)
+	return c, err
+}
+
+// getConfig returns the current Config, it may change anytime.
+func (h *Handler) getConfig() Config {
+	h.configLock.RLock()
+	defer h.configLock.RUnlock()
+
+	return h.config
+}
+
+// getMOTD returns the current MOTD, callers must not modify it.
+func (h *Handler) getMOTD() *motd.Config {
+	h.configLock.RLock()
+	defer h.configLock.RUnlock()
+
+	return h.motd
+}
+
+// setProxy swaps the PROXY protocol policy of the listener, new connections use it.
+func (h *Handler) setProxy(c Config) error {
+	if !c.ProxyProtocol {
+		h.proxyPolicy.Store(proxyproto.PolicyFunc(func(net.Addr) (proxyproto.Policy, error) {
+			return proxyproto.SKIP, nil
+		}))
+		return nil
+	}
+
+	// Untrusted clients can send a PROXY header too, it gets ignored for them
+	policy, err := proxyproto.LaxWhiteListPolicy(c.TrustedProxies)
+	if err != nil {
+		return err
+	}
+
+	h.proxyPolicy.Store(policy)
+	logruscomponent.MustReg(h.cReg).Logger().Infof("PROXY protocol enabled for: %v", c.TrustedProxies)
+	return nil
+}
+
+// policy is the proxyproto.PolicyFunc of the listener, it asks the policy setProxy stored last.
+func (h *Handler) policy(upstream net.Addr) (proxyproto.Policy, error) {
+	return h.proxyPolicy.Load().(proxyproto.PolicyFunc)(upstream)
+}
+
+// listen opens the listener for c, call setProxy first.
+func (h *Handler) listen(c Config) (net.Listener, error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", c.Host, c.Port))
+	if err != nil {
+		return nil, err
+	}
+
+	logruscomponent.MustReg(h.cReg).Logger().Infof("Lobbyserver listening on: %s:%d", c.Host, c.Port)
+	return &proxyproto.Listener{Listener: listener, Policy: h.policy}, nil
+}
+
+// rebind moves the listener to the address of c, on errors the old address stays. On the same
+// port the old listener may hold the new address (0.0.0.0 and 127.0.0.1), it gets closed first then.
+// The caller holds configLock.
+func (h *Handler) rebind(c Config) error {
+	old := h.listener
+	samePort := c.Port == h.config.Port
+	if samePort {
+		old.Close()
+	}
+
+	listener, err := h.listen(c)
+	if err != nil {
+		if samePort {
+			// Take the old address back
+			l, lErr := h.listen(h.config)
+			if lErr != nil {
+				logruscomponent.MustReg(h.cReg).Logger().Error("Failed to re-bind the old address, the lobby doesn't listen anymore: ", lErr)
+				return err
+			}
+			h.listener = l
+			go h.acceptLoop(l)
+		}
+		return err
+	}
+
+	if !samePort {
+		old.Close()
+	}
+	h.listener = listener
+	go h.acceptLoop(listener)
+	return nil
+}
+
+// reload applies a changed Config, connections which are already open stay on the old listener.
+func (h *Handler) reload() {
+	logger := logruscomponent.MustReg(h.cReg).Logger()
+
+	ctx, err := auth2.ClientAuthMustReg(h.cReg).Plugin().ServiceContext(context.Background())
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	c, err := h.loadConfig(ctx)
+	if err != nil {
+		logger.WithField("setting", configName).Error("Failed to reload the config: ", err)
+		return
+	}
+
+	h.configLock.Lock()
+	defer h.configLock.Unlock()
+
+	// The policy applies to the running listener, there's no need to re-bind for it
+	if h.config.needsProxy(c) {
+		if err := h.setProxy(c); err != nil {
+			logger.Error("Failed to apply the PROXY protocol settings, keeping the old ones: ", err)
+			c.ProxyProtocol = h.config.ProxyProtocol
+			c.TrustedProxies = h.config.TrustedProxies
+		}
+	}
+
+	// Stop closed the listener already, don't open a new one
+	if h.listener != nil && h.config.needsListen(c) {
+		if err := h.rebind(c); err != nil {
+			logger.Error("Failed to re-bind the lobby, keeping the old address: ", err)
+			c.Host = h.config.Host
+			c.Port = h.config.Port
+		}
+	}
+
+	h.config = c
+	logger.Info("Reloaded the config")
+}
+
+// reloadMOTD swaps the MOTD, the next list or addg answers with the new one.
+func (h *Handler) reloadMOTD() {
+	logger := logruscomponent.MustReg(h.cReg).Logger()
+
+	ctx, err := auth2.ClientAuthMustReg(h.cReg).Plugin().ServiceContext(context.Background())
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	m, err := motd.Load(ctx, h.cReg)
+	if err != nil {
+		logger.WithField("setting", motd.Name).Error("Failed to reload the MOTD: ", err)
+		return
+	}
+
+	h.configLock.Lock()
+	h.motd = m
+	h.configLock.Unlock()
+
+	logger.Info("Reloaded the MOTD")
+}
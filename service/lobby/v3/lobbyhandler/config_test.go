@@ -0,0 +1,64 @@
+package lobbyhandler
+
+import (
+	"net"
+	"testing"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func TestConfigChanges(t *testing.T) {
+	base := defaultConfig()
+	base.ProxyProtocol = true
+	base.TrustedProxies = []string{"10.0.0.1", "10.0.1.0/24"}
+
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		listen bool
+		proxy  bool
+	}{
+		{"unchanged", func(c *Config) {}, false, false},
+		{"host", func(c *Config) { c.Host = "127.0.0.1" }, true, false},
+		{"port", func(c *Config) { c.Port++ }, true, false},
+		{"proxy off", func(c *Config) { c.ProxyProtocol = false }, false, true},
+		{"proxy added", func(c *Config) { c.TrustedProxies = append(c.TrustedProxies, "10.0.2.1") }, false, true},
+		{"proxy changed", func(c *Config) { c.TrustedProxies = []string{"10.0.0.1", "10.0.2.0/24"} }, false, true},
+		{"other", func(c *Config) { c.IdleTimeout++ }, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := base
+			n.TrustedProxies = append([]string{}, base.TrustedProxies...)
+			tt.change(&n)
+
+			if got := base.needsListen(n); got != tt.listen {
+				t.Errorf("needsListen = %v, want %v", got, tt.listen)
+			}
+			if got := base.needsProxy(n); got != tt.proxy {
+				t.Errorf("needsProxy = %v, want %v", got, tt.proxy)
+			}
+		})
+	}
+}
+
+func TestSetProxy(t *testing.T) {
+	h := New()
+	upstream := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 40000}
+
+	if err := h.setProxy(Config{}); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := h.policy(upstream); err != nil || p != proxyproto.SKIP {
+		t.Errorf("policy without PROXY protocol = %v, %v, want SKIP", p, err)
+	}
+
+	// A broken list keeps the last policy
+	if err := h.setProxy(Config{ProxyProtocol: true, TrustedProxies: []string{"10.0.0.0/33"}}); err == nil {
+		t.Error("setProxy accepted an invalid network")
+	}
+	if p, err := h.policy(upstream); err != nil || p != proxyproto.SKIP {
+		t.Errorf("policy after a failed change = %v, %v, want SKIP", p, err)
+	}
+}
@@ -2,57 +2,41 @@ package lobbyhandler
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
+	stderrors "errors"
+	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/pires/go-proxyproto"
+	"github.com/sirupsen/logrus"
+	"go-micro.dev/v4/errors"
+	"jochum.dev/jo-micro/auth2"
 	"jochum.dev/jo-micro/components"
 	"jochum.dev/jo-micro/logruscomponent"
+	"wz2100.net/microlobby/service/lobby/v3/capture"
+	"wz2100.net/microlobby/shared/gamestruct"
+	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+	"wz2100.net/microlobby/shared/utils"
 )
 
-type gameStruct struct {
-	Version        uint32
-	Name           []byte `struc:"[64]int32"` // 64 Chars
-	DwSize         int32
-	DwFlags        int32
-	Host           []byte `struc:"[40]int32"` // 40 chars
-	MaxPlayers     int32
-	CurrentPlayers int32
-	DwUserFlag0    int32
-	DwUserFlag1    int32
-	DwUserFlag2    int32
-	DwUserFlag3    int32
-	Host2          []byte `struc:"[40]int32"`  // 40 chars
-	Host3          []byte `struc:"[40]int32"`  // 40 chars
-	Extra          []byte `struc:"[157]int32"` // 157 chars
-	Port           uint16
-	MapName        []byte `struc:"[40]int32"`  // 40 chars
-	HostName       []byte `struc:"[40]int32"`  // 40 chars
-	VersionString  []byte `struc:"[64]int32"`  // 64 chars
-	ModList        []byte `struc:"[255]int32"` // 255 chars
-	VersionMajor   uint32
-	VersionMinor   uint32
-	Private        uint32
-	Pure           uint32
-	Mods           uint32
-	GameId         uint32
-	Future2        uint32
-	Future3        uint32
-	Future4        uint32
-}
-
-const gameStructSize = 4 + 64 + (4 * 2) + 40 + (4 * 6) + 40 + 40 + 157 + 2 + 40 + 40 + 64 + 255 + (4 * 9)
-
-func stringToPaddedByte(in string, size int) []byte {
-	out := make([]byte, size)
-	if len(in) > size {
-		copy(out, []byte(in[0:size-1]))
-	} else {
-		copy(out, []byte(in))
-	}
-
-	return out
-}
+const (
+	statusOK    = 200
+	statusError = 400
+
+	unreachableMessage = "Your game is not reachable from the internet, check your firewall and port forwarding settings"
+	restartingMessage  = "The lobby is restarting, please host your game again in a moment"
+)
+
+// errDraining is returned by readCommand when Shutdown came first
+var errDraining = stderrors.New("draining")
 
 func byteToString(in []byte) string {
 	return string(bytes.Trim(in, "\x00"))
@@ -62,46 +46,415 @@ type ConnHandler struct {
 	cReg    *components.Registry
 	conn    net.Conn
 	closing bool
+
+	// lock guards writes to conn and gameId updates, Shutdown runs in another goroutine
+	lock sync.Mutex
+	// gameId is the gamedb ID of the game this connection hosts
+	gameId   string
+	draining atomic.Bool
 }
 
 func NewConnHandler(cReg *components.Registry, conn net.Conn) (*ConnHandler, error) {
+	if dir := MustReg(cReg).getConfig().CaptureDir; len(dir) > 0 {
+		// A broken capture dir must not keep clients out
+		w, err := capture.Create(dir, conn.RemoteAddr().String())
+		if err != nil {
+			logruscomponent.MustReg(cReg).Logger().WithField("remote", conn.RemoteAddr().String()).Error("Failed to start a capture: ", err)
+		} else {
+			conn = capture.NewConn(conn, w)
+		}
+	}
+
 	return &ConnHandler{cReg: cReg, conn: conn, closing: false}, nil
 }
 
+// writeStatus writes the lobby response frame: status code, message length and the message itself.
+func writeStatus(buf *bytes.Buffer, code uint32, message string) error {
+	if err := binary.Write(buf, binary.BigEndian, code); err != nil {
+		return err
+	}
+	if err := binary.Write(buf, binary.BigEndian, uint32(len(message))); err != nil {
+		return err
+	}
+	_, err := buf.WriteString(message)
+	return err
+}
+
+// refusal reads the rest of cmd from r and returns the answer which makes the client show message.
+func refusal(r io.Reader, cmd string, code uint32, message string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	switch cmd {
+	case "list":
+		if err := binary.Write(buf, binary.BigEndian, uint32(0)); err != nil {
+			return nil, err
+		}
+		if err := writeStatus(buf, code, message); err != nil {
+			return nil, err
+		}
+		if err := binary.Write(buf, binary.BigEndian, uint32(0)); err != nil {
+			return nil, err
+		}
+	case "gaid":
+		// gaid has no status, the client sends addg next and gamedb picks an id for 0
+		if err := binary.Write(buf, binary.BigEndian, uint32(0)); err != nil {
+			return nil, err
+		}
+	case "addg":
+		if err := gamestruct.Discard(r); err != nil {
+			return nil, err
+		}
+		if err := writeStatus(buf, code, message); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown command: %s", cmd)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (h *ConnHandler) list(ctx context.Context, logger *logrus.Entry) error {
+	gamedb, err := MustReg(h.cReg).gameDBClient()
+	if err != nil {
+		return err
+	}
+
+	result, err := gamedb.List(ctx, &gamedbpb.ListRequest{})
+	if err != nil {
+		return err
+	}
+
+	games := []*gamestruct.Game{}
+	for _, pg := range result.Games {
+		if pg.IsPrivate {
+			continue
+		}
+
+		games = append(games, gamestruct.FromProto(pg))
+	}
+
+	buf := &bytes.Buffer{}
+	if err := binary.Write(buf, binary.BigEndian, uint32(len(games))); err != nil {
+		return err
+	}
+	for _, g := range games {
+		data, err := g.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	}
+
+	// The list command doesn't tell us the clients version
+	if err := writeStatus(buf, statusOK, MustReg(h.cReg).getMOTD().Text("", "", time.Now())); err != nil {
+		return err
+	}
+
+	// 4.x clients read the lobby server flags after the status, 0 means there's no second games list.
+	if err := binary.Write(buf, binary.BigEndian, uint32(0)); err != nil {
+		return err
+	}
+
+	if err := h.write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	logger.WithField("games", len(games)).Trace("Sent the games list")
+	return nil
+}
+
+func (h *ConnHandler) write(data []byte) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	_, err := h.conn.Write(data)
+	return err
+}
+
+func (h *ConnHandler) setGameId(id string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.gameId = id
+}
+
+// Shutdown tells a host that the lobby restarts and stops the connection after its current command,
+// a connection which waits for a command stops right away.
+func (h *ConnHandler) Shutdown() {
+	h.draining.Store(true)
+
+	h.lock.Lock()
+	hosting := len(h.gameId) > 0
+	h.lock.Unlock()
+
+	if hosting {
+		if err := h.writeStatus(statusError, restartingMessage); err != nil {
+			logruscomponent.MustReg(h.cReg).Logger().WithField("remote", h.conn.RemoteAddr().String()).Error(err)
+		}
+	}
+
+	// Wake up readCommand, Serve removes the game then
+	if err := h.conn.SetReadDeadline(time.Now()); err != nil {
+		logruscomponent.MustReg(h.cReg).Logger().WithField("remote", h.conn.RemoteAddr().String()).Error(err)
+	}
+}
+
+// Close closes the connection, Serve removes the hosted game then.
+func (h *ConnHandler) Close() error {
+	return h.conn.Close()
+}
+
+func addrIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+
+	return host
+}
+
+func (h *ConnHandler) remoteIP() string {
+	return addrIP(h.conn.RemoteAddr())
+}
+
+func (h *ConnHandler) writeStatus(code uint32, message string) error {
+	buf := &bytes.Buffer{}
+	if err := writeStatus(buf, code, message); err != nil {
+		return err
+	}
+
+	return h.write(buf.Bytes())
+}
+
+// allowed takes a token from the remotes bucket for cmd
+func (h *ConnHandler) allowed(cmd string, logger *logrus.Entry) bool {
+	l, ok := MustReg(h.cReg).getConfig().RateLimits[cmd]
+	if !ok || l.Burst < 1 {
+		return true
+	}
+
+	// NATS KV keys don't allow ":"
+	key := cmd + "." + strings.ReplaceAll(h.remoteIP(), ":", "_")
+	ok, err := MustReg(h.cReg).limiter.Allow(key, l)
+	if err != nil {
+		logger.WithField("cmd", cmd).Warn("Rate limiter failed, allowing the command: ", err)
+	}
+
+	return ok
+}
+
+func (h *ConnHandler) newGameId(ctx context.Context, logger *logrus.Entry) error {
+	gamedb, err := MustReg(h.cReg).gameDBClient()
+	if err != nil {
+		return err
+	}
+
+	result, err := gamedb.NextV3GameId(ctx, &empty.Empty{})
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	if err := binary.Write(buf, binary.BigEndian, result.V3GameId); err != nil {
+		return err
+	}
+	if err := h.write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	logger.WithField("gameId", result.V3GameId).Trace("Sent a game id")
+	return nil
+}
+
+func (h *ConnHandler) addGame(ctx context.Context, logger *logrus.Entry) error {
+	g, err := gamestruct.Read(h.conn)
+	if err != nil {
+		return err
+	}
+
+	m := MustReg(h.cReg).getMOTD()
+	if m.Maintenance {
+		logger.WithField("cmd", "addg").Info("Rejected game, the lobby is in maintenance")
+		if err := h.writeStatus(statusError, m.Text("", "", time.Now())); err != nil {
+			return err
+		}
+
+		h.closing = true
+		return nil
+	}
+
+	gamedb, err := MustReg(h.cReg).gameDBClient()
+	if err != nil {
+		return err
+	}
+
+	// A host re-registering on the same connection replaces its old game
+	if err := h.deleteGame(ctx, logger, gamedbpb.DeleteReason_DELETE_REASON_REPLACED); err != nil {
+		return err
+	}
+
+	config := MustReg(h.cReg).getConfig()
+	if config.ProbeTimeout > 0 {
+		if err := utils.ProbeHost(ctx, h.remoteIP(), uint32(g.Port), time.Duration(config.ProbeTimeout)*time.Second); err != nil {
+			logger.WithField("cmd", "addg").WithField("port", g.Port).Info("Host is unreachable: ", err)
+			if err := h.writeStatus(statusError, unreachableMessage); err != nil {
+				return err
+			}
+
+			h.closing = true
+			return nil
+		}
+	}
+
+	// gamedb runs the names through the badwords policy
+	result, err := gamedb.Create(ctx, gamestruct.ToProto(g, h.remoteIP()))
+	if mErr := errors.FromError(err); err != nil && mErr.Id == "PROFANE_GAME" {
+		logger.WithField("cmd", "addg").Info("Rejected profane game: ", mErr.Detail)
+		if err := h.writeStatus(statusError, mErr.Detail); err != nil {
+			return err
+		}
+
+		h.closing = true
+		return nil
+	} else if err != nil {
+		logger.WithField("cmd", "addg").Error(err)
+		if err := h.writeStatus(statusError, "Failed to register your game, please try again later"); err != nil {
+			return err
+		}
+
+		h.closing = true
+		return nil
+	}
+
+	h.setGameId(result.Id)
+	logger.WithField("game", h.gameId).Info("Registered game")
+
+	return h.writeStatus(statusOK, m.Text(g.VersionString, "", time.Now()))
+}
+
+// deleteGame removes the game this connection hosts from the gamedb.
+func (h *ConnHandler) deleteGame(ctx context.Context, logger *logrus.Entry, reason gamedbpb.DeleteReason) error {
+	if len(h.gameId) < 1 {
+		return nil
+	}
+
+	gamedb, err := MustReg(h.cReg).gameDBClient()
+	if err != nil {
+		return err
+	}
+
+	// An admin may have removed it already
+	if _, err := gamedb.Delete(ctx, &gamedbpb.DeleteRequest{Id: h.gameId, Reason: reason}); err != nil && errors.FromError(err).Code != http.StatusNotFound {
+		return err
+	}
+
+	logger.WithField("game", h.gameId).Info("Removed game")
+	h.setGameId("")
+	return nil
+}
+
+// readCommand waits for the next command, Shutdown interrupts the wait.
+func (h *ConnHandler) readCommand(config Config) (string, error) {
+	// Hosts keep the connection open as long as their game lives, everyone else has to be quick
+	var deadline time.Time
+	if len(h.gameId) < 1 && config.IdleTimeout > 0 {
+		deadline = time.Now().Add(time.Duration(config.IdleTimeout) * time.Second)
+	}
+	if err := h.conn.SetDeadline(deadline); err != nil {
+		return "", err
+	}
+
+	// Shutdown may have set its deadline before ours
+	if h.draining.Load() {
+		return "", errDraining
+	}
+
+	// TCP and the PROXY protocol reader may split the command
+	cmdBuf := make([]byte, 5)
+	if _, err := io.ReadFull(h.conn, cmdBuf); err != nil {
+		return "", err
+	}
+
+	return strings.ToLower(byteToString(cmdBuf)), nil
+}
+
 func (h *ConnHandler) Serve() {
 	myLogger := logruscomponent.MustReg(h.cReg).Logger().WithField("remote", h.conn.RemoteAddr().String())
+	raw := h.conn
+	if cc, ok := raw.(*capture.Conn); ok {
+		myLogger = myLogger.WithField("capture", cc.Name())
+		raw = cc.Conn
+	}
+	if pc, ok := raw.(*proxyproto.Conn); ok && pc.ProxyHeader() != nil {
+		myLogger = myLogger.WithField("proxy", pc.Raw().RemoteAddr().String())
+	}
 	myLogger.Info("Got a connection")
-	for !h.closing {
-		cmdBuf := make([]byte, 5)
-		n, err := h.conn.Read(cmdBuf)
+
+	for !h.closing && !h.draining.Load() {
+		// Reloads reach open connections with their next command
+		config := MustReg(h.cReg).getConfig()
+		cmd, err := h.readCommand(config)
 		if err != nil {
-			// Do not log EOF
-			if err == io.EOF || err == io.ErrUnexpectedEOF {
-				h.closing = true
-				break
+			switch netErr, ok := err.(net.Error); {
+			case h.draining.Load(), err == io.EOF, err == io.ErrUnexpectedEOF:
+				// Do not log EOF and the interrupt of Shutdown
+			case ok && netErr.Timeout():
+				myLogger.Debug("Idle timeout")
+			default:
+				myLogger.Error(err)
 			}
 
-			myLogger.Error(err)
 			h.closing = true
 			break
 		}
-		if n != 5 {
-			myLogger.Errorf("Can't read 5 bytes command String? Got '%v'(%d)", cmdBuf, n)
+
+		if config.CommandTimeout > 0 {
+			if err := h.conn.SetDeadline(time.Now().Add(time.Duration(config.CommandTimeout) * time.Second)); err != nil {
+				myLogger.Error(err)
+				break
+			}
+		}
+
+		if !h.allowed(cmd, myLogger) {
+			myLogger.WithField("cmd", cmd).Debug("Too many requests")
+			data, err := refusal(h.conn, cmd, statusTooManyRequests, tooManyRequestsMessage)
+			if err == nil {
+				err = h.write(data)
+			}
+			if err != nil {
+				myLogger.WithField("cmd", cmd).Error(err)
+				h.closing = true
+			}
+			continue
+		}
+
+		// Hosts stay for hours, the service token of the connection start is gone by then
+		ctx, err := auth2.ClientAuthMustReg(h.cReg).Plugin().ServiceContext(context.Background())
+		if err != nil {
+			myLogger.Error(err)
 			h.closing = true
 			break
 		}
 
-		cmd := strings.ToLower(byteToString(cmdBuf))
 		switch cmd {
 		case "list":
 			myLogger.WithField("cmd", cmd).Trace("Executing")
-			break
+			if err := h.list(ctx, myLogger); err != nil {
+				myLogger.WithField("cmd", cmd).Error(err)
+				h.closing = true
+			}
 		case "gaid":
 			myLogger.WithField("cmd", cmd).Trace("Executing")
-			break
+			if err := h.newGameId(ctx, myLogger); err != nil {
+				myLogger.WithField("cmd", cmd).Error(err)
+				h.closing = true
+			}
 		case "addg":
 			myLogger.WithField("cmd", cmd).Trace("Executing")
-			break
+			if err := h.addGame(ctx, myLogger); err != nil {
+				myLogger.WithField("cmd", cmd).Error(err)
+				h.closing = true
+			}
 		default:
 			myLogger.WithField("cmd", cmd).Error("Unknown command")
 			h.closing = true
@@ -109,5 +462,14 @@ func (h *ConnHandler) Serve() {
 		}
 	}
 
+	// The connection is the keepalive of a hosted game, remove the game once it's gone
+	ctx, err := auth2.ClientAuthMustReg(h.cReg).Plugin().ServiceContext(context.Background())
+	if err == nil {
+		err = h.deleteGame(ctx, myLogger, gamedbpb.DeleteReason_DELETE_REASON_DISCONNECTED)
+	}
+	if err != nil {
+		myLogger.Error(err)
+	}
+
 	h.conn.Close()
 }
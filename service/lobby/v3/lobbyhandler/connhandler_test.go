@@ -0,0 +1,125 @@
+package lobbyhandler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"wz2100.net/microlobby/shared/gamestruct"
+)
+
+func status(code uint32, message string) []byte {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.BigEndian, code)
+	binary.Write(buf, binary.BigEndian, uint32(len(message)))
+	buf.WriteString(message)
+	return buf.Bytes()
+}
+
+func TestRefusal(t *testing.T) {
+	zero := []byte{0, 0, 0, 0}
+	game, err := (&gamestruct.Game{Version: gamestruct.Version4}).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		cmd   string
+		input []byte
+		want  []byte
+		left  int
+	}{
+		{"list", "list", nil, append(append(append([]byte{}, zero...), status(429, "slow")...), zero...), 0},
+		{"gaid", "gaid", nil, zero, 0},
+		{"addg", "addg", append(append([]byte{}, game...), 'x'), status(429, "slow"), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bytes.NewReader(tt.input)
+			got, err := refusal(r, tt.cmd, 429, "slow")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("refusal = %x, want %x", got, tt.want)
+			}
+			if r.Len() != tt.left {
+				t.Errorf("refusal left %d bytes, want %d", r.Len(), tt.left)
+			}
+		})
+	}
+
+	if _, err := refusal(bytes.NewReader(nil), "addg", 429, "slow"); err == nil {
+		t.Error("refusal of addg without a game didn't fail")
+	}
+	if _, err := refusal(bytes.NewReader(nil), "join", 429, "slow"); err == nil {
+		t.Error("refusal of an unknown command didn't fail")
+	}
+}
+
+func TestShutdownDrains(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	// A host waits for commands without a deadline
+	h := New()
+	sh := &ConnHandler{conn: server}
+	sh.setGameId("game")
+
+	read := make(chan error, 1)
+	h.connsWg.Add(1)
+	go func() {
+		defer h.connsWg.Done()
+		_, err := sh.readCommand(Config{IdleTimeout: 60})
+		read <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	go sh.Shutdown()
+
+	// The host learns about the restart
+	want := status(statusError, restartingMessage)
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(client, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Shutdown wrote %q, want %q", got, want)
+	}
+
+	if !h.waitConns(time.Second) {
+		t.Fatal("the connection didn't drain")
+	}
+	if err := <-read; err == nil {
+		t.Error("readCommand didn't fail")
+	}
+
+	// Shutdown before the wait starts
+	if _, err := sh.readCommand(Config{}); err != errDraining {
+		t.Errorf("readCommand after Shutdown = %v, want errDraining", err)
+	}
+}
+
+func TestReadCommandSplit(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	go func() {
+		client.Write([]byte("li"))
+		client.Write([]byte("st\x00"))
+	}()
+
+	sh := &ConnHandler{conn: server}
+	cmd, err := sh.readCommand(Config{IdleTimeout: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd != "list" {
+		t.Errorf("readCommand = %q, want list", cmd)
+	}
+}
@@ -2,36 +2,57 @@ package lobbyhandler
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/pires/go-proxyproto"
 	"github.com/urfave/cli/v2"
 	"go-micro.dev/v4/errors"
 	"jochum.dev/jo-micro/auth2"
 	"jochum.dev/jo-micro/components"
 	"jochum.dev/jo-micro/logruscomponent"
+	"jochum.dev/jo-micro/router"
+	gamedbConfig "wz2100.net/microlobby/service/gamedb/v1/config"
 	"wz2100.net/microlobby/service/settings"
-	"wz2100.net/microlobby/shared/proto/settingsservicepb/v1"
+	"wz2100.net/microlobby/shared/motd"
+	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+	"wz2100.net/microlobby/shared/proto/lobbypb/v3"
+	"wz2100.net/microlobby/shared/utils"
 )
 
-type Config struct {
-	Host string `json:"host"`
-	Port int32  `json:"port"`
-}
-
 const Name = "lobbyV3Handler"
 
 type Handler struct {
 	cReg        *components.Registry
 	initialized bool
 
-	config   Config
-	listener net.Listener
+	// configLock guards config, motd, bans and listener, they change on reload
+	configLock sync.RWMutex
+	config     Config
+	motd       *motd.Config
+	bans       *banList
+	listener   net.Listener
+
+	// proxyPolicy holds the proxyproto.PolicyFunc of the listener, see setProxy
+	proxyPolicy atomic.Value
+
+	limiter limiter
+
+	connsLock    sync.Mutex
+	conns        int
+	connsPerIP   map[string]int
+	connHandlers map[*ConnHandler]struct{}
+	connsWg      sync.WaitGroup
 }
 
 func New() *Handler {
-	return &Handler{initialized: false}
+	return &Handler{
+		initialized:  false,
+		connsPerIP:   make(map[string]int),
+		connHandlers: make(map[*ConnHandler]struct{}),
+	}
 }
 
 func MustReg(cReg *components.Registry) *Handler {
@@ -63,77 +84,300 @@ func (h *Handler) Init(components *components.Registry, cli *cli.Context) error
 		return errors.FromError(err)
 	}
 
-	s := settings.MustReg(h.cReg)
+	h.config, err = h.loadConfig(ctx)
 	if err != nil {
-		return errors.FromError(err)
+		return err
 	}
 
-	var c Config
-	se, err := s.Get(ctx, "", "", h.cReg.Service().Name(), "config")
-	if err == nil {
-		err = json.Unmarshal(se.Content, &c)
-		if err != nil {
-			return errors.FromError(err)
-		}
-	} else {
-		c.Host = "0.0.0.0"
-		c.Port = 9990
+	h.motd, err = motd.Load(ctx, h.cReg)
+	if err != nil {
+		return err
+	}
 
-		craw, err := json.Marshal(&c)
-		if err != nil {
-			return errors.FromError(err)
-		}
+	bans, err := h.loadBans(ctx)
+	if err != nil {
+		return err
+	}
+	h.setBans(bans)
 
-		if _, err = s.Upsert(ctx, &settingsservicepb.UpsertRequest{
-			Service:     h.cReg.Service().Name(),
-			Name:        "config",
-			Content:     craw,
-			RolesRead:   []string{auth2.ROLE_ADMIN, auth2.ROLE_SERVICE},
-			RolesUpdate: []string{auth2.ROLE_ADMIN, auth2.ROLE_SERVICE},
-		}); err != nil {
-			return errors.FromError(err)
-		}
+	h.limiter = h.newLimiter(cli.String("lobby_v3_ratelimit_nats"))
+
+	if err := h.setProxy(h.config); err != nil {
+		return errors.FromError(err)
 	}
-	h.config = c
 
-	logruscomponent.MustReg(h.cReg).Logger().Infof("Lobbyserver listening on: %s:%d", h.config.Host, h.config.Port)
-	h.listener, err = net.Listen("tcp", fmt.Sprintf("%s:%d", h.config.Host, h.config.Port))
+	h.listener, err = h.listen(h.config)
 	if err != nil {
 		return errors.FromError(err)
 	}
 
-	go func() {
-		for {
-			conn, err := h.listener.Accept()
-			if err != nil {
+	go h.acceptLoop(h.listener)
+
+	// A single settings Upsert reconfigures all lobbies
+	settings.MustReg(h.cReg).Watch(h.cReg.Service().Name(), configName, func(ctx context.Context) {
+		h.reload()
+	})
+	settings.MustReg(h.cReg).Watch(motd.Service, motd.Name, func(ctx context.Context) {
+		h.reloadMOTD()
+	})
+	settings.MustReg(h.cReg).Watch(h.cReg.Service().Name(), bansName, func(ctx context.Context) {
+		h.reloadBans()
+	})
+
+	r := router.MustReg(h.cReg)
+	r.Add(
+		router.NewRoute(
+			router.Method(router.MethodGet),
+			router.Path("/bans"),
+			router.Endpoint(lobbypb.LobbyV3Service.ListBans),
+			router.AuthRequired(),
+		),
+		router.NewRoute(
+			router.Method(router.MethodPost),
+			router.Path("/bans"),
+			router.Endpoint(lobbypb.LobbyV3Service.CreateBan),
+			router.AuthRequired(),
+		),
+		router.NewRoute(
+			router.Method(router.MethodDelete),
+			router.Path("/bans/:id"),
+			router.Endpoint(lobbypb.LobbyV3Service.DeleteBan),
+			router.Params("id"),
+			router.AuthRequired(),
+		),
+	)
+
+	lobbypb.RegisterLobbyV3ServiceHandler(h.cReg.Service().Server(), h)
+
+	h.initialized = true
+	return nil
+}
+
+// acceptLoop runs until listener gets closed, on Stop or when reload opened a new one.
+func (h *Handler) acceptLoop(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			// Stop and reload replace the listener before they close it
+			h.configLock.RLock()
+			current := h.listener == listener
+			h.configLock.RUnlock()
+
+			if current {
 				logruscomponent.MustReg(h.cReg).Logger().Error(err)
-				break
 			}
+			break
+		}
 
-			sh, err := NewConnHandler(h.cReg, conn)
-			if err != nil {
-				logruscomponent.MustReg(h.cReg).Logger().Error(err)
-				continue
+		if !h.acquireConn() {
+			// Don't ask a proxied connection for its address here, that would block on the PROXY header
+			remote := conn.RemoteAddr()
+			if pc, ok := conn.(*proxyproto.Conn); ok {
+				remote = pc.Raw().RemoteAddr()
 			}
+			logruscomponent.MustReg(h.cReg).Logger().WithField("remote", remote.String()).Warn("Rejected connection, too many connections")
+			conn.Close()
+			continue
+		}
+
+		h.connsWg.Add(1)
+		go h.serve(conn)
+	}
+}
+
+func (h *Handler) acquireConn() bool {
+	config := h.getConfig()
+
+	h.connsLock.Lock()
+	defer h.connsLock.Unlock()
+
+	if config.MaxConnections > 0 && h.conns >= config.MaxConnections {
+		return false
+	}
+
+	h.conns++
+	return true
+}
+
+func (h *Handler) releaseConn() {
+	h.connsLock.Lock()
+	defer h.connsLock.Unlock()
+
+	h.conns--
+}
+
+func (h *Handler) acquireIP(ip string) bool {
+	config := h.getConfig()
+
+	h.connsLock.Lock()
+	defer h.connsLock.Unlock()
+
+	if config.MaxConnectionsPerIP > 0 && h.connsPerIP[ip] >= config.MaxConnectionsPerIP {
+		return false
+	}
+
+	h.connsPerIP[ip]++
+	return true
+}
+
+func (h *Handler) releaseIP(ip string) {
+	h.connsLock.Lock()
+	defer h.connsLock.Unlock()
 
-			go sh.Serve()
+	h.connsPerIP[ip]--
+	if h.connsPerIP[ip] < 1 {
+		delete(h.connsPerIP, ip)
+	}
+}
+
+// serve runs a connection which has been accepted and counted by the accept loop
+func (h *Handler) serve(conn net.Conn) {
+	defer h.connsWg.Done()
+	defer h.releaseConn()
+
+	ip := addrIP(conn.RemoteAddr())
+	if ban := h.getBans().match(ip, time.Now()); ban != nil {
+		logruscomponent.MustReg(h.cReg).Logger().WithField("remote", conn.RemoteAddr().String()).WithField("ban", ban.Id).Info("Rejected banned connection")
+		if err := rejectBanned(conn, ban.message()); err != nil {
+			logruscomponent.MustReg(h.cReg).Logger().WithField("remote", conn.RemoteAddr().String()).Debug(err)
 		}
+		conn.Close()
+		return
+	}
+
+	if !h.acquireIP(ip) {
+		logruscomponent.MustReg(h.cReg).Logger().WithField("remote", conn.RemoteAddr().String()).Warn("Rejected connection, too many connections from this IP")
+		conn.Close()
+		return
+	}
+	defer h.releaseIP(ip)
+
+	sh, err := NewConnHandler(h.cReg, conn)
+	if err != nil {
+		logruscomponent.MustReg(h.cReg).Logger().Error(err)
+		conn.Close()
+		return
+	}
+
+	h.connsLock.Lock()
+	h.connHandlers[sh] = struct{}{}
+	h.connsLock.Unlock()
+
+	sh.Serve()
+
+	h.connsLock.Lock()
+	delete(h.connHandlers, sh)
+	h.connsLock.Unlock()
+}
+
+// waitConns waits until all connections are done or the timeout has been reached
+func (h *Handler) waitConns(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		h.connsWg.Wait()
+		close(done)
 	}()
 
-	h.initialized = true
-	return nil
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// drain stops all connections, hosts get told that the lobby restarts and their games get removed.
+func (h *Handler) drain() {
+	h.connsLock.Lock()
+	handlers := make([]*ConnHandler, 0, len(h.connHandlers))
+	for sh := range h.connHandlers {
+		handlers = append(handlers, sh)
+	}
+	h.connsLock.Unlock()
+
+	if len(handlers) < 1 {
+		return
+	}
+
+	gracePeriod := time.Duration(h.getConfig().ShutdownGracePeriod) * time.Second
+	logger := logruscomponent.MustReg(h.cReg).Logger()
+	logger.Infof("Draining %d connections", len(handlers))
+	for _, sh := range handlers {
+		sh.Shutdown()
+	}
+
+	if h.waitConns(gracePeriod) {
+		return
+	}
+
+	// Close the remaining connections, Serve removes their games
+	h.connsLock.Lock()
+	for sh := range h.connHandlers {
+		sh.Close()
+	}
+	h.connsLock.Unlock()
+
+	if !h.waitConns(gracePeriod) {
+		logger.Error("Not all connections stopped in time, their games may stay in the gamedb")
+	}
 }
 
 func (h *Handler) Stop() error {
+	h.configLock.Lock()
 	if h.listener != nil {
 		h.listener.Close()
 		h.listener = nil
 	}
+	h.configLock.Unlock()
+
+	h.drain()
+
+	if h.limiter != nil {
+		h.limiter.Close()
+	}
 	return nil
 }
 
+func (h *Handler) gameDBClient() (gamedbpb.GameDBV1Service, error) {
+	// Wait until the service is here
+	_, err := utils.ServiceRetryGet(h.cReg.Service(), gamedbConfig.Name, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	return gamedbpb.NewGameDBV1Service(gamedbConfig.Name, h.cReg.Service().Client()), nil
+}
+
+// newLimiter shares rate limits over NATS KV, without NATS every instance limits on its own
+func (h *Handler) newLimiter(url string) limiter {
+	logger := logruscomponent.MustReg(h.cReg).Logger()
+
+	if len(url) < 1 {
+		if b := h.cReg.Service().Options().Broker; b.String() == "nats" {
+			url = b.Address()
+		}
+	}
+	if len(url) < 1 {
+		logger.Info("No NATS for the rate limits, limiting per instance")
+		return newMemoryLimiter()
+	}
+
+	l, err := newNATSLimiter(url)
+	if err != nil {
+		logger.Error("Failed to connect to NATS for the rate limits, limiting per instance: ", err)
+		return newMemoryLimiter()
+	}
+
+	return l
+}
+
 func (h *Handler) Flags(r *components.Registry) []cli.Flag {
-	return []cli.Flag{}
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "lobby_v3_ratelimit_nats",
+			Usage: "NATS URL to share the rate limits between replicas, defaults to the NATS broker",
+		},
+	}
 }
 
 func (h *Handler) Health(context context.Context) error {
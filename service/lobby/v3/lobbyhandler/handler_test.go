@@ -0,0 +1,90 @@
+package lobbyhandler
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnectionLimits(t *testing.T) {
+	h := New()
+	h.config = Config{MaxConnections: 3, MaxConnectionsPerIP: 2}
+
+	steps := []struct {
+		ip   string
+		want bool
+	}{
+		{"192.0.2.1", true},
+		{"192.0.2.1", true},
+		{"192.0.2.1", false},
+		{"192.0.2.2", true},
+		// The global limit counts every IP
+		{"192.0.2.3", false},
+	}
+
+	for i, s := range steps {
+		got := h.acquireConn()
+		if got {
+			if got = h.acquireIP(s.ip); !got {
+				h.releaseConn()
+			}
+		}
+		if got != s.want {
+			t.Errorf("step %d: acquire %s = %v, want %v", i, s.ip, got, s.want)
+		}
+	}
+
+	h.releaseIP("192.0.2.2")
+	h.releaseConn()
+	if _, ok := h.connsPerIP["192.0.2.2"]; ok {
+		t.Error("a released IP is still counted")
+	}
+	if !h.acquireConn() || !h.acquireIP("192.0.2.3") {
+		t.Error("a released connection isn't available again")
+	}
+
+	// 0 disables the limits
+	h.config = Config{}
+	for i := 0; i < 10; i++ {
+		if !h.acquireConn() || !h.acquireIP("192.0.2.1") {
+			t.Fatal("acquire failed without limits")
+		}
+	}
+}
+
+func TestAddrIP(t *testing.T) {
+	tests := []struct {
+		addr net.Addr
+		want string
+	}{
+		{&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 2100}, "192.0.2.1"},
+		{&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 2100}, "2001:db8::1"},
+		{&net.UnixAddr{Name: "/run/lobby.sock", Net: "unix"}, "/run/lobby.sock"},
+	}
+
+	for _, tt := range tests {
+		if got := addrIP(tt.addr); got != tt.want {
+			t.Errorf("addrIP(%v) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestWaitConns(t *testing.T) {
+	h := New()
+	if !h.waitConns(time.Millisecond) {
+		t.Error("waitConns without connections timed out")
+	}
+
+	h.connsWg.Add(1)
+	if h.waitConns(10 * time.Millisecond) {
+		t.Error("waitConns didn't wait for a running connection")
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		h.connsWg.Done()
+	}()
+	if !h.waitConns(time.Second) {
+		t.Error("waitConns timed out after the connection stopped")
+	}
+}
@@ -0,0 +1,172 @@
+package lobbyhandler
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	statusTooManyRequests  = 429
+	tooManyRequestsMessage = "Too many requests, please wait a moment"
+
+	// rateLimitBucket is the NATS KV bucket all lobby_v3 replicas share
+	rateLimitBucket = "lobby_v3_ratelimit"
+	// rateLimitTTL is the time after which an unused bucket is forgotten, it starts full again
+	rateLimitTTL = time.Hour
+	// rateLimitAttempts limits the retries when another replica updated a bucket at the same time
+	rateLimitAttempts = 5
+)
+
+type RateLimit struct {
+	// Rate is the number of commands per second which get added to the bucket
+	Rate float64 `json:"rate"`
+	// Burst is the size of the bucket, 0 disables the limit
+	Burst int `json:"burst"`
+}
+
+// bucket is the state of a token bucket
+type bucket struct {
+	Tokens float64 `json:"tokens"`
+	Last   int64   `json:"last"`
+}
+
+// take refills the bucket for the time since the last call and takes a token if there's one
+func (b *bucket) take(l RateLimit, now time.Time) bool {
+	if b.Last == 0 {
+		b.Tokens = float64(l.Burst)
+	} else if elapsed := now.Sub(time.Unix(0, b.Last)).Seconds(); elapsed > 0 {
+		b.Tokens = math.Min(float64(l.Burst), b.Tokens+elapsed*l.Rate)
+	}
+	b.Last = now.UnixNano()
+
+	if b.Tokens < 1 {
+		return false
+	}
+
+	b.Tokens--
+	return true
+}
+
+type limiter interface {
+	// Allow takes a token from the bucket key
+	Allow(key string, l RateLimit) (bool, error)
+	Close() error
+}
+
+// memoryLimiter keeps the buckets in this instance, it's used when there's no NATS
+type memoryLimiter struct {
+	lock      sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func newMemoryLimiter() *memoryLimiter {
+	return &memoryLimiter{buckets: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+func (m *memoryLimiter) Allow(key string, l RateLimit) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastSweep) > time.Minute {
+		for k, b := range m.buckets {
+			if now.Sub(time.Unix(0, b.Last)) > rateLimitTTL {
+				delete(m.buckets, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{}
+		m.buckets[key] = b
+	}
+
+	return b.take(l, now), nil
+}
+
+func (m *memoryLimiter) Close() error {
+	return nil
+}
+
+// natsLimiter shares the buckets with all replicas through NATS KV
+type natsLimiter struct {
+	nc *nats.Conn
+	kv nats.KeyValue
+}
+
+func newNATSLimiter(url string) (*natsLimiter, error) {
+	nc, err := nats.Connect(url)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := nc.JetStream()
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	kv, err := js.KeyValue(rateLimitBucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      rateLimitBucket,
+			Description: "lobby v3 rate limits per IP and command",
+			TTL:         rateLimitTTL,
+		})
+	}
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	return &natsLimiter{nc: nc, kv: kv}, nil
+}
+
+func (n *natsLimiter) Allow(key string, l RateLimit) (bool, error) {
+	var err error
+	for i := 0; i < rateLimitAttempts; i++ {
+		b := &bucket{}
+		revision := uint64(0)
+
+		entry, gErr := n.kv.Get(key)
+		if gErr == nil {
+			if err := json.Unmarshal(entry.Value(), b); err != nil {
+				return true, err
+			}
+			revision = entry.Revision()
+		} else if !errors.Is(gErr, nats.ErrKeyNotFound) && !errors.Is(gErr, nats.ErrKeyDeleted) {
+			return true, gErr
+		}
+
+		allowed := b.take(l, time.Now())
+		data, mErr := json.Marshal(b)
+		if mErr != nil {
+			return true, mErr
+		}
+
+		// Create and Update fail when another replica was faster, try again with its state
+		if revision == 0 {
+			_, err = n.kv.Create(key, data)
+		} else {
+			_, err = n.kv.Update(key, data, revision)
+		}
+		if err == nil {
+			return allowed, nil
+		}
+	}
+
+	return true, err
+}
+
+func (n *natsLimiter) Close() error {
+	n.nc.Close()
+	return nil
+}
@@ -0,0 +1,63 @@
+package lobbyhandler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketTake(t *testing.T) {
+	start := time.Unix(1666094400, 0)
+	l := RateLimit{Rate: 0.5, Burst: 2}
+
+	steps := []struct {
+		after time.Duration
+		want  bool
+	}{
+		// A new bucket starts full
+		{0, true},
+		{0, true},
+		{0, false},
+		// Half a token isn't enough
+		{time.Second, false},
+		{2 * time.Second, true},
+		{2 * time.Second, false},
+		// It doesn't fill over the burst
+		{time.Minute, true},
+		{time.Minute, true},
+		{time.Minute, false},
+		// The clock going back doesn't add tokens
+		{50 * time.Second, false},
+	}
+
+	b := &bucket{}
+	for i, s := range steps {
+		if got := b.take(l, start.Add(s.after)); got != s.want {
+			t.Errorf("step %d: take at +%v = %v, want %v (tokens %.2f)", i, s.after, got, s.want, b.Tokens)
+		}
+	}
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	m := newMemoryLimiter()
+	l := RateLimit{Rate: 0, Burst: 1}
+
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"list.192.0.2.1", true},
+		{"list.192.0.2.1", false},
+		{"addg.192.0.2.1", true},
+		{"list.192.0.2.2", true},
+	}
+
+	for _, tt := range tests {
+		got, err := m.Allow(tt.key, l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Allow(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"go-micro.dev/v4/logger"
 	"jochum.dev/jo-micro/auth2"
 	jwtClient "jochum.dev/jo-micro/auth2/plugins/client/jwt"
+	"jochum.dev/jo-micro/auth2/plugins/verifier/endpointroles"
 	"jochum.dev/jo-micro/components"
 	"jochum.dev/jo-micro/logruscomponent"
 	"jochum.dev/jo-micro/router"
@@ -13,6 +14,7 @@ import (
 	"wz2100.net/microlobby/service/lobby/v3/lobbyhandler"
 	"wz2100.net/microlobby/service/settings"
 	_ "wz2100.net/microlobby/shared/micro_plugins"
+	"wz2100.net/microlobby/shared/proto/lobbypb/v3"
 )
 
 func main() {
@@ -42,6 +44,25 @@ func main() {
 				return err
 			}
 
+			authVerifier := endpointroles.NewVerifier(
+				endpointroles.WithLogrus(logruscomponent.MustReg(cReg).Logger()),
+			)
+			authVerifier.AddRules(
+				endpointroles.NewRule(
+					endpointroles.Endpoint(lobbypb.LobbyV3Service.ListBans),
+					endpointroles.RolesAllow(auth2.RolesServiceAndAdmin),
+				),
+				endpointroles.NewRule(
+					endpointroles.Endpoint(lobbypb.LobbyV3Service.CreateBan),
+					endpointroles.RolesAllow(auth2.RolesServiceAndAdmin),
+				),
+				endpointroles.NewRule(
+					endpointroles.Endpoint(lobbypb.LobbyV3Service.DeleteBan),
+					endpointroles.RolesAllow(auth2.RolesServiceAndAdmin),
+				),
+			)
+			auth2ClientReg.Plugin().AddVerifier(authVerifier)
+
 			return nil
 		}),
 	)
@@ -0,0 +1,55 @@
+// standin is a local webhook target for the notifier, it prints every post it gets.
+//
+//	standin -listen :8095 -fail 2
+//
+// Point a target of the notifier to http://<host>:8095/ to see what Discord would get.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+func main() {
+	listen := flag.String("listen", ":8095", "Address to listen on")
+	fail := flag.Int("fail", 0, "Answer the first N posts with -status to test retries")
+	status := flag.Int("status", http.StatusServiceUnavailable, "Status code of failed posts")
+	retryAfter := flag.Int("retry-after", 0, "Retry-After in seconds of failed posts, 0 sends none")
+	flag.Parse()
+
+	var lock sync.Mutex
+	count := 0
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		lock.Lock()
+		count++
+		n := count
+		lock.Unlock()
+
+		fmt.Printf("#%d %s %s (%s)\n%s\n\n", n, r.Method, r.URL.Path, r.Header.Get("Content-Type"), body)
+
+		if n <= *fail {
+			if *retryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(*retryAfter))
+			}
+			w.WriteHeader(*status)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	log.Printf("Listening on %s", *listen)
+	log.Fatal(http.ListenAndServe(*listen, nil))
+}
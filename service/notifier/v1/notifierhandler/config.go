@@ -0,0 +1,151 @@
+package notifierhandler
+
+import (
+	"context"
+	"strings"
+
+	"wz2100.net/microlobby/service/settings"
+	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+)
+
+// configName is the name of the setting which holds the Config
+const configName = "config"
+
+// Events a target can subscribe to, they are the topic suffixes from docs/events.md
+const (
+	EventGameCreated  = "game.created"
+	EventGameUpdated  = "game.updated"
+	EventGameDeleted  = "game.deleted"
+	EventPlayerJoined = "player.joined"
+	EventPlayerLeft   = "player.left"
+)
+
+// Formats wrap the rendered text for the target
+const (
+	// FormatDiscord posts {"content": text}
+	FormatDiscord = "discord"
+	// FormatSlack posts {"text": text}, most chats understand that
+	FormatSlack = "slack"
+	// FormatRaw posts the text as it is with the ContentType of the target
+	FormatRaw = "raw"
+)
+
+type Filter struct {
+	// Maps the game must be on, case insensitive, empty allows all
+	Maps []string `json:"maps"`
+	// Versions are prefixes of the game version, "4." matches "4.3.2", empty allows all
+	Versions []string `json:"versions"`
+	// MinPlayers is the number of players which must be in the game
+	MinPlayers uint32 `json:"min_players"`
+	// MinSlots is the minimum of max players, 4 skips 1v1 games
+	MinSlots uint32 `json:"min_slots"`
+}
+
+func (f *Filter) match(g *gamedbpb.Game) bool {
+	if len(f.Maps) > 0 {
+		found := false
+		for _, m := range f.Maps {
+			if strings.EqualFold(m, g.Map) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(f.Versions) > 0 {
+		found := false
+		for _, v := range f.Versions {
+			if strings.HasPrefix(g.Version, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return uint32(len(g.Players)) >= f.MinPlayers && g.MaxPlayers >= f.MinSlots
+}
+
+type RateLimit struct {
+	// Rate is the number of posts per second
+	Rate float64 `json:"rate"`
+	// Burst is the number of posts which may go out at once, 0 disables the limit
+	Burst int `json:"burst"`
+}
+
+type Target struct {
+	// Name identifies the target in logs
+	Name string `json:"name"`
+	URL  string `json:"url"`
+
+	// Format is one of discord, slack or raw
+	Format      string            `json:"format"`
+	ContentType string            `json:"content_type"`
+	Headers     map[string]string `json:"headers"`
+
+	// Events to post, empty means game.created only
+	Events []string `json:"events"`
+	// Templates override the global templates per event
+	Templates map[string]string `json:"templates"`
+
+	Filter    Filter    `json:"filter"`
+	RateLimit RateLimit `json:"rate_limit"`
+}
+
+func (t *Target) wants(event string) bool {
+	if len(t.Events) == 0 {
+		return event == EventGameCreated
+	}
+
+	for _, e := range t.Events {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+type Config struct {
+	Targets []Target `json:"targets"`
+
+	// Templates are text/templates per event
+	Templates map[string]string `json:"templates"`
+
+	// Retries is the number of retries for failed posts
+	Retries int `json:"retries"`
+	// Backoff is the time in seconds before the first retry, it doubles with every retry up to MaxBackoff
+	Backoff    int `json:"backoff"`
+	MaxBackoff int `json:"max_backoff"`
+
+	// Timeout is the time in seconds a target has to answer
+	Timeout int `json:"timeout"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		Targets: []Target{},
+		Templates: map[string]string{
+			EventGameCreated:  `New game "{{ .Game.Description }}" on {{ .Game.Map }} ({{ len .Game.Players }}/{{ .Game.MaxPlayers }} players, {{ .Game.Version }})`,
+			EventGameUpdated:  `Game "{{ .Game.Description }}" changed: {{ join .ChangedFields ", " }}`,
+			EventGameDeleted:  `Game "{{ .Game.Description }}" is gone ({{ .Reason }})`,
+			EventPlayerJoined: `{{ .Player.Name }} joined "{{ .Game.Description }}" ({{ len .Game.Players }}/{{ .Game.MaxPlayers }} players)`,
+			EventPlayerLeft:   `{{ .Player.Name }} left "{{ .Game.Description }}" ({{ len .Game.Players }}/{{ .Game.MaxPlayers }} players)`,
+		},
+		Retries:    5,
+		Backoff:    1,
+		MaxBackoff: 60,
+		Timeout:    10,
+	}
+}
+
+func (h *Handler) loadConfig(ctx context.Context) (Config, error) {
+	c := defaultConfig()
+	err := settings.MustReg(h.cReg).LoadJSON(ctx, h.cReg.Service().Name(), configName, &c)
+	return c, err
+}
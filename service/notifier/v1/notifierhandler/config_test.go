@@ -0,0 +1,64 @@
+package notifierhandler
+
+import (
+	"testing"
+
+	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+)
+
+func TestFilterMatch(t *testing.T) {
+	g := &gamedbpb.Game{
+		Map:        "Sk-Rush",
+		Version:    "4.3.2",
+		MaxPlayers: 4,
+		Players:    []*gamedbpb.Player{{Name: "host"}, {Name: "player"}},
+	}
+
+	tests := []struct {
+		name string
+		f    Filter
+		want bool
+	}{
+		{"empty", Filter{}, true},
+		{"map", Filter{Maps: []string{"Sk-Startup", "sk-rush"}}, true},
+		{"other map", Filter{Maps: []string{"Sk-Startup"}}, false},
+		{"version", Filter{Versions: []string{"3.", "4."}}, true},
+		{"other version", Filter{Versions: []string{"4.4"}}, false},
+		{"enough players", Filter{MinPlayers: 2}, true},
+		{"too few players", Filter{MinPlayers: 3}, false},
+		{"enough slots", Filter{MinSlots: 4}, true},
+		{"too few slots", Filter{MinSlots: 8}, false},
+		{"all", Filter{Maps: []string{"Sk-Rush"}, Versions: []string{"4."}, MinPlayers: 2, MinSlots: 4}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.f.match(g); got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTargetWants(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+		event  string
+		want   bool
+	}{
+		{"default created", nil, EventGameCreated, true},
+		{"default deleted", nil, EventGameDeleted, false},
+		{"listed", []string{EventGameDeleted, EventPlayerJoined}, EventPlayerJoined, true},
+		{"not listed", []string{EventGameDeleted}, EventGameCreated, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := &Target{Events: tt.events}
+			if got := target.wants(tt.event); got != tt.want {
+				t.Errorf("wants(%s) = %v, want %v", tt.event, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package notifierhandler
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/urfave/cli/v2"
+	"go-micro.dev/v4"
+	"go-micro.dev/v4/errors"
+	"go-micro.dev/v4/server"
+	"google.golang.org/protobuf/proto"
+	"jochum.dev/jo-micro/auth2"
+	"jochum.dev/jo-micro/components"
+	"jochum.dev/jo-micro/logruscomponent"
+	gamedbConfig "wz2100.net/microlobby/service/gamedb/v1/config"
+	"wz2100.net/microlobby/service/notifier/v1/config"
+	"wz2100.net/microlobby/service/settings"
+	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+	"wz2100.net/microlobby/shared/utils"
+)
+
+const Name = "notifierHandler"
+
+// payload is what templates get
+type payload struct {
+	Event         string
+	Meta          *gamedbpb.EventMeta
+	Game          *gamedbpb.Game
+	Player        *gamedbpb.Player
+	ChangedFields []string
+	// Reason of a deleted game, like "closed" or "disconnected"
+	Reason string
+}
+
+type Handler struct {
+	cReg        *components.Registry
+	initialized bool
+
+	workersLock sync.RWMutex
+	workers     []*worker
+	stop        chan struct{}
+
+	// games are the known games, player events only have the id of theirs
+	gamesLock sync.RWMutex
+	games     map[string]*gamedbpb.Game
+}
+
+func New() *Handler {
+	return &Handler{
+		initialized: false,
+		workers:     []*worker{},
+		stop:        make(chan struct{}),
+		games:       make(map[string]*gamedbpb.Game),
+	}
+}
+
+func MustReg(cReg *components.Registry) *Handler {
+	return cReg.Must(Name).(*Handler)
+}
+
+func (h *Handler) Name() string {
+	return Name
+}
+
+func (h *Handler) Priority() int {
+	return 100
+}
+
+func (h *Handler) Initialized() bool {
+	return h.initialized
+}
+
+func (h *Handler) Init(components *components.Registry, cli *cli.Context) error {
+	if h.initialized {
+		return nil
+	}
+
+	h.cReg = components
+	s := h.cReg.Service().Server()
+
+	// No queue, every notifier needs all games
+	if err := micro.RegisterSubscriber(gamedbConfig.TopicEvents, s, h.onGameEvent); err != nil {
+		return errors.FromError(err)
+	}
+
+	// Queued, only one notifier posts an event
+	queue := server.SubscriberQueue(config.Name)
+	subscribers := map[string]interface{}{
+		gamedbConfig.TopicGameCreated:  h.onGameCreated,
+		gamedbConfig.TopicGameUpdated:  h.onGameUpdated,
+		gamedbConfig.TopicGameDeleted:  h.onGameDeleted,
+		gamedbConfig.TopicPlayerJoined: h.onPlayerJoined,
+		gamedbConfig.TopicPlayerLeft:   h.onPlayerLeft,
+	}
+	for topic, handler := range subscribers {
+		if err := micro.RegisterSubscriber(topic, s, handler, queue); err != nil {
+			return errors.FromError(err)
+		}
+	}
+
+	settings.MustReg(h.cReg).Watch(h.cReg.Service().Name(), configName, func(ctx context.Context) {
+		h.reload()
+	})
+	h.reload()
+
+	go h.seed()
+
+	h.initialized = true
+	return nil
+}
+
+func (h *Handler) Stop() error {
+	close(h.stop)
+
+	h.workersLock.Lock()
+	defer h.workersLock.Unlock()
+
+	for _, w := range h.workers {
+		close(w.queue)
+	}
+	h.workers = []*worker{}
+
+	return nil
+}
+
+func (h *Handler) Flags(r *components.Registry) []cli.Flag {
+	return []cli.Flag{}
+}
+
+func (h *Handler) Health(context context.Context) error {
+	return nil
+}
+
+// reload replaces the workers, the old ones post what they have queued
+func (h *Handler) reload() {
+	logger := logruscomponent.MustReg(h.cReg).Logger()
+
+	ctx, err := auth2.ClientAuthMustReg(h.cReg).Plugin().ServiceContext(context.Background())
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	c, err := h.loadConfig(ctx)
+	if err != nil {
+		logger.WithField("setting", configName).Error("Failed to reload the config: ", err)
+		return
+	}
+
+	workers := []*worker{}
+	for _, t := range c.Targets {
+		w, err := newWorker(t, &c, logger.WithField("component", Name), h.stop)
+		if err != nil {
+			logger.Error("Failed to reload the config, keeping the old targets: ", err)
+			return
+		}
+		workers = append(workers, w)
+	}
+
+	h.workersLock.Lock()
+	defer h.workersLock.Unlock()
+
+	select {
+	case <-h.stop:
+		return
+	default:
+	}
+
+	for _, w := range h.workers {
+		close(w.queue)
+	}
+	for _, w := range workers {
+		go w.run()
+	}
+	h.workers = workers
+
+	logger.WithField("targets", len(workers)).Info("Reloaded the config")
+}
+
+// seed fills the known games once, later the events keep them current
+func (h *Handler) seed() {
+	logger := logruscomponent.MustReg(h.cReg).Logger()
+
+	ctx, err := auth2.ClientAuthMustReg(h.cReg).Plugin().ServiceContext(context.Background())
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	// Wait until the service is here
+	if _, err := utils.ServiceRetryGet(h.cReg.Service(), gamedbConfig.Name, 10); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	gamedb := gamedbpb.NewGameDBV1Service(gamedbConfig.Name, h.cReg.Service().Client())
+	result, err := gamedb.List(ctx, &gamedbpb.ListRequest{})
+	if err != nil {
+		logger.Error("Failed to load the games: ", err)
+		return
+	}
+
+	h.gamesLock.Lock()
+	defer h.gamesLock.Unlock()
+
+	for _, g := range result.Games {
+		// Events are newer
+		if _, ok := h.games[g.Id]; !ok {
+			h.games[g.Id] = g
+		}
+	}
+}
+
+// game returns the game with id, player events can be faster than the GameEvent of a new game
+// or come before seed, gamedb knows it then.
+func (h *Handler) game(ctx context.Context, id string) (*gamedbpb.Game, error) {
+	h.gamesLock.RLock()
+	g, ok := h.games[id]
+	h.gamesLock.RUnlock()
+	if ok {
+		return g, nil
+	}
+
+	// Don't remember it, the GameEvent brings it and a GameDeleted could be faster than us
+	sCtx, err := auth2.ClientAuthMustReg(h.cReg).Plugin().ServiceContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	gamedb := gamedbpb.NewGameDBV1Service(gamedbConfig.Name, h.cReg.Service().Client())
+	return gamedb.Get(sCtx, &gamedbpb.GetRequest{Id: id})
+}
+
+func (h *Handler) onGameEvent(ctx context.Context, ev *gamedbpb.GameEvent) error {
+	h.gamesLock.Lock()
+	defer h.gamesLock.Unlock()
+
+	if ev.Action == gamedbpb.GameEvent_DELETED {
+		delete(h.games, ev.Game.Id)
+	} else {
+		h.games[ev.Game.Id] = ev.Game
+	}
+
+	return nil
+}
+
+// notify renders the payload for each target which wants it
+func (h *Handler) notify(p *payload) {
+	// Chats are public, never tell them about private games
+	if p.Game == nil || p.Game.IsPrivate {
+		return
+	}
+
+	// Nor about IP's
+	p.Game = proto.Clone(p.Game).(*gamedbpb.Game)
+	p.Game.HostIp = ""
+	for _, gp := range p.Game.Players {
+		gp.IpAddress = ""
+	}
+	if p.Player != nil {
+		p.Player = proto.Clone(p.Player).(*gamedbpb.Player)
+		p.Player.IpAddress = ""
+	}
+
+	h.workersLock.RLock()
+	defer h.workersLock.RUnlock()
+
+	for _, w := range h.workers {
+		if !w.wants(p.Event) || !w.Filter.match(p.Game) {
+			continue
+		}
+
+		body, err := w.render(p)
+		if err != nil {
+			w.logger.Error("Failed to render: ", err)
+			continue
+		}
+
+		w.enqueue(body)
+	}
+}
+
+func (h *Handler) onGameCreated(ctx context.Context, ev *gamedbpb.GameCreated) error {
+	if ev.Meta.GetSchemaVersion() != gamedbConfig.EventSchemaVersion {
+		return nil
+	}
+
+	h.notify(&payload{Event: EventGameCreated, Meta: ev.Meta, Game: ev.Game})
+	return nil
+}
+
+func (h *Handler) onGameUpdated(ctx context.Context, ev *gamedbpb.GameUpdated) error {
+	if ev.Meta.GetSchemaVersion() != gamedbConfig.EventSchemaVersion {
+		return nil
+	}
+
+	h.notify(&payload{Event: EventGameUpdated, Meta: ev.Meta, Game: ev.Game, ChangedFields: ev.ChangedFields})
+	return nil
+}
+
+func (h *Handler) onGameDeleted(ctx context.Context, ev *gamedbpb.GameDeleted) error {
+	if ev.Meta.GetSchemaVersion() != gamedbConfig.EventSchemaVersion {
+		return nil
+	}
+
+	h.notify(&payload{Event: EventGameDeleted, Meta: ev.Meta, Game: ev.Game, Reason: strings.ToLower(strings.TrimPrefix(ev.Reason.String(), "DELETE_REASON_"))})
+	return nil
+}
+
+func (h *Handler) onPlayerJoined(ctx context.Context, ev *gamedbpb.PlayerJoined) error {
+	if ev.Meta.GetSchemaVersion() != gamedbConfig.EventSchemaVersion {
+		return nil
+	}
+
+	g, err := h.game(ctx, ev.GameId)
+	if err != nil {
+		logruscomponent.MustReg(h.cReg).Logger().WithField("game", ev.GameId).Warn("Dropped a player event of an unknown game: ", err)
+		return nil
+	}
+
+	h.notify(&payload{Event: EventPlayerJoined, Meta: ev.Meta, Game: g, Player: ev.Player})
+	return nil
+}
+
+func (h *Handler) onPlayerLeft(ctx context.Context, ev *gamedbpb.PlayerLeft) error {
+	if ev.Meta.GetSchemaVersion() != gamedbConfig.EventSchemaVersion {
+		return nil
+	}
+
+	g, err := h.game(ctx, ev.GameId)
+	if err != nil {
+		logruscomponent.MustReg(h.cReg).Logger().WithField("game", ev.GameId).Warn("Dropped a player event of an unknown game: ", err)
+		return nil
+	}
+
+	h.notify(&payload{Event: EventPlayerLeft, Meta: ev.Meta, Game: g, Player: ev.Player})
+	return nil
+}
@@ -0,0 +1,255 @@
+package notifierhandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// queueSize is the number of posts a target may lag behind, newer ones get dropped
+const queueSize = 100
+
+// templateFuncs are available in all templates
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// retryableError is a failed post which may work later, after is the time the target asked us to wait
+type retryableError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+// worker posts to one target, one at a time so the rate limit holds
+type worker struct {
+	Target
+
+	templates map[string]*template.Template
+	client    *http.Client
+	logger    *logrus.Entry
+
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+
+	queue chan []byte
+	// stop aborts waiting for the rate limit or a retry, Stop closes it
+	stop chan struct{}
+
+	tokens float64
+	last   time.Time
+}
+
+func newWorker(t Target, c *Config, logger *logrus.Entry, stop chan struct{}) (*worker, error) {
+	w := &worker{
+		Target:     t,
+		templates:  make(map[string]*template.Template),
+		client:     &http.Client{Timeout: time.Duration(c.Timeout) * time.Second},
+		logger:     logger.WithField("target", t.Name),
+		retries:    c.Retries,
+		backoff:    time.Duration(c.Backoff) * time.Second,
+		maxBackoff: time.Duration(c.MaxBackoff) * time.Second,
+		queue:      make(chan []byte, queueSize),
+		stop:       stop,
+		tokens:     float64(t.RateLimit.Burst),
+	}
+
+	if len(w.Format) < 1 {
+		w.Format = FormatDiscord
+	}
+
+	switch w.Format {
+	case FormatDiscord, FormatSlack:
+		w.ContentType = "application/json"
+	case FormatRaw:
+		if len(w.ContentType) < 1 {
+			w.ContentType = "text/plain; charset=utf-8"
+		}
+	default:
+		return nil, fmt.Errorf("target %s: unknown format '%s'", t.Name, t.Format)
+	}
+
+	for _, event := range []string{EventGameCreated, EventGameUpdated, EventGameDeleted, EventPlayerJoined, EventPlayerLeft} {
+		if !w.wants(event) {
+			continue
+		}
+
+		text, ok := t.Templates[event]
+		if !ok {
+			text, ok = c.Templates[event]
+		}
+		if !ok {
+			return nil, fmt.Errorf("target %s: no template for '%s'", t.Name, event)
+		}
+
+		tmpl, err := template.New(event).Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("target %s: %w", t.Name, err)
+		}
+		w.templates[event] = tmpl
+	}
+
+	return w, nil
+}
+
+// render executes the template of the event and wraps it in the targets format
+func (w *worker) render(p *payload) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := w.templates[p.Event].Execute(&buf, p); err != nil {
+		return nil, err
+	}
+
+	switch w.Format {
+	case FormatDiscord:
+		return json.Marshal(map[string]string{"content": buf.String()})
+	case FormatSlack:
+		return json.Marshal(map[string]string{"text": buf.String()})
+	}
+
+	return buf.Bytes(), nil
+}
+
+// enqueue hands a post to the worker, it never blocks the broker
+func (w *worker) enqueue(body []byte) {
+	select {
+	case w.queue <- body:
+	default:
+		w.logger.Warn("Queue is full, dropping a post")
+	}
+}
+
+// sleep waits for d, it returns false when the notifier stops
+func (w *worker) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-w.stop:
+		return false
+	}
+}
+
+// wait blocks until the rate limit allows the next post
+func (w *worker) wait() bool {
+	if w.RateLimit.Burst <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	if !w.last.IsZero() {
+		w.tokens = math.Min(float64(w.RateLimit.Burst), w.tokens+now.Sub(w.last).Seconds()*w.RateLimit.Rate)
+	}
+	w.last = now
+
+	if w.tokens < 1 {
+		if w.RateLimit.Rate <= 0 {
+			w.logger.Warn("Rate limit without a rate, the burst is used up for good")
+			return false
+		}
+
+		d := time.Duration((1 - w.tokens) / w.RateLimit.Rate * float64(time.Second))
+		if !w.sleep(d) {
+			return false
+		}
+		w.tokens = 1
+		w.last = time.Now()
+	}
+
+	w.tokens--
+	return true
+}
+
+func (w *worker) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.ContentType)
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+
+	rsp, err := w.client.Do(req)
+	if err != nil {
+		return &retryableError{err: err}
+	}
+	defer rsp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(rsp.Body, 4096))
+
+	if rsp.StatusCode >= 200 && rsp.StatusCode < 300 {
+		return nil
+	}
+
+	err = fmt.Errorf("target answered with %s", rsp.Status)
+	if rsp.StatusCode == http.StatusTooManyRequests || rsp.StatusCode >= 500 {
+		rErr := &retryableError{err: err}
+		if seconds, pErr := strconv.ParseFloat(rsp.Header.Get("Retry-After"), 64); pErr == nil {
+			rErr.after = time.Duration(seconds * float64(time.Second))
+		}
+		return rErr
+	}
+
+	// Other client errors won't get better
+	return err
+}
+
+// send posts with retries and exponential backoff
+func (w *worker) send(body []byte) {
+	backoff := w.backoff
+	for attempt := 0; ; attempt++ {
+		if !w.wait() {
+			return
+		}
+
+		err := w.post(body)
+		if err == nil {
+			return
+		}
+
+		rErr, ok := err.(*retryableError)
+		if !ok || attempt >= w.retries {
+			w.logger.WithField("attempts", attempt+1).Error("Failed to post: ", err)
+			return
+		}
+
+		d := backoff
+		if rErr.after > d {
+			d = rErr.after
+		}
+		w.logger.WithField("attempt", attempt+1).Debugf("Post failed, retrying in %s: %s", d, err)
+		if !w.sleep(d) {
+			return
+		}
+
+		backoff *= 2
+		if backoff > w.maxBackoff {
+			backoff = w.maxBackoff
+		}
+	}
+}
+
+// run posts until the queue gets closed by a reload
+func (w *worker) run() {
+	for body := range w.queue {
+		w.send(body)
+	}
+}
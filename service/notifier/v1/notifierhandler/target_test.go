@@ -0,0 +1,106 @@
+package notifierhandler
+
+import (
+	"io"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+)
+
+func testLogger() *logrus.Entry {
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	return logrus.NewEntry(l)
+}
+
+func TestNewWorker(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      Target
+		contentType string
+		err         bool
+	}{
+		{"discord by default", Target{}, "application/json", false},
+		{"slack", Target{Format: FormatSlack, ContentType: "text/plain"}, "application/json", false},
+		{"raw", Target{Format: FormatRaw}, "text/plain; charset=utf-8", false},
+		{"raw with type", Target{Format: FormatRaw, ContentType: "text/markdown"}, "text/markdown", false},
+		{"unknown format", Target{Format: "irc"}, "", true},
+		{"no template", Target{Events: []string{"game.unknown", EventGameCreated}}, "application/json", false},
+		{"broken template", Target{Templates: map[string]string{EventGameCreated: "{{ .Game"}}, "", true},
+		{"broken unused template", Target{Templates: map[string]string{EventGameDeleted: "{{ .Game"}}, "application/json", false},
+	}
+
+	c := defaultConfig()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := newWorker(tt.target, &c, testLogger(), nil)
+			if tt.err {
+				if err == nil {
+					t.Error("newWorker didn't fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w.ContentType != tt.contentType {
+				t.Errorf("ContentType = %q, want %q", w.ContentType, tt.contentType)
+			}
+		})
+	}
+
+	// The global templates must have every event
+	c.Templates = map[string]string{}
+	if _, err := newWorker(Target{}, &c, testLogger(), nil); err == nil {
+		t.Error("newWorker without a template didn't fail")
+	}
+}
+
+func TestRender(t *testing.T) {
+	p := &payload{
+		Game: &gamedbpb.Game{
+			Description: `Say "hi"`,
+			Map:         "Sk-Rush",
+			Version:     "4.3.2",
+			MaxPlayers:  4,
+			Players:     []*gamedbpb.Player{{Name: "host"}},
+		},
+		Player:        &gamedbpb.Player{Name: "player"},
+		ChangedFields: []string{"description", "map"},
+		Reason:        "closed",
+	}
+
+	events := []string{EventGameCreated, EventGameUpdated, EventGameDeleted, EventPlayerJoined, EventPlayerLeft}
+	tests := []struct {
+		name   string
+		target Target
+		event  string
+		want   string
+	}{
+		{"discord", Target{}, EventGameCreated, `{"content":"New game \"Say \"hi\"\" on Sk-Rush (1/4 players, 4.3.2)"}`},
+		{"slack", Target{Format: FormatSlack, Events: events}, EventGameUpdated, `{"text":"Game \"Say \"hi\"\" changed: description, map"}`},
+		{"raw", Target{Format: FormatRaw, Events: events}, EventGameDeleted, `Game "Say "hi"" is gone (closed)`},
+		{"joined", Target{Format: FormatRaw, Events: events}, EventPlayerJoined, `player joined "Say "hi"" (1/4 players)`},
+		{"own template", Target{Format: FormatRaw, Events: events, Templates: map[string]string{EventPlayerLeft: "{{ .Player.Name }} is gone"}}, EventPlayerLeft, "player is gone"},
+	}
+
+	c := defaultConfig()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := newWorker(tt.target, &c, testLogger(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p.Event = tt.event
+			body, err := w.render(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tt.want {
+				t.Errorf("render = %s, want %s", body, tt.want)
+			}
+		})
+	}
+}
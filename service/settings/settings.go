@@ -2,12 +2,17 @@ package settings
 
 import (
 	"context"
+	"encoding/json"
+	stderrors "errors"
 	"fmt"
+	"net/http"
 	"sync"
 
+	"go-micro.dev/v4"
 	"go-micro.dev/v4/errors"
 
 	"github.com/urfave/cli/v2"
+	"jochum.dev/jo-micro/auth2"
 	"jochum.dev/jo-micro/components"
 	"wz2100.net/microlobby/service/settings/v1/config"
 	"wz2100.net/microlobby/shared/proto/settingsservicepb/v1"
@@ -23,8 +28,13 @@ type Handler struct {
 	cacheGet      map[string]*settingsservicepb.Setting
 	cacheListLock *sync.RWMutex
 	cacheList     map[string][]*settingsservicepb.Setting
+	watchersLock  *sync.RWMutex
+	watchers      map[string][]WatchFunc
 }
 
+// WatchFunc gets called after a watched setting has been created or updated
+type WatchFunc func(ctx context.Context)
+
 func MustReg(cReg *components.Registry) *Handler {
 	return cReg.Must(Name).(*Handler)
 }
@@ -49,6 +59,8 @@ func New() *Handler {
 		cacheGet:      make(map[string]*settingsservicepb.Setting),
 		cacheListLock: &sync.RWMutex{},
 		cacheList:     make(map[string][]*settingsservicepb.Setting),
+		watchersLock:  &sync.RWMutex{},
+		watchers:      make(map[string][]WatchFunc),
 	}
 }
 
@@ -81,10 +93,50 @@ func (h *Handler) Init(cReg *components.Registry, cli *cli.Context) error {
 
 	h.cReg = cReg
 
+	// No queue, every instance has to invalidate its cache
+	if err := micro.RegisterSubscriber(config.TopicChanged, h.cReg.Service().Server(), h.onChanged); err != nil {
+		return err
+	}
+
 	h.initialized = true
 	return nil
 }
 
+// flush drops all cached results, cache keys mix ids, owners and services so simply start over.
+// Writes flush without waiting for the changed event, a Get right after them must see the new content.
+func (h *Handler) flush() {
+	h.cacheGetLock.Lock()
+	h.cacheGet = make(map[string]*settingsservicepb.Setting)
+	h.cacheGetLock.Unlock()
+
+	h.cacheListLock.Lock()
+	h.cacheList = make(map[string][]*settingsservicepb.Setting)
+	h.cacheListLock.Unlock()
+}
+
+func (h *Handler) onChanged(ctx context.Context, ev *settingsservicepb.ChangedEvent) error {
+	h.flush()
+
+	h.watchersLock.RLock()
+	watchers := h.watchers[fmt.Sprintf("%s-%s", ev.Service, ev.Name)]
+	h.watchersLock.RUnlock()
+
+	for _, w := range watchers {
+		w(ctx)
+	}
+
+	return nil
+}
+
+// Watch calls cb each time the setting name of service changes, cb has to Get the new content
+func (h *Handler) Watch(service, name string, cb WatchFunc) {
+	key := fmt.Sprintf("%s-%s", service, name)
+
+	h.watchersLock.Lock()
+	h.watchers[key] = append(h.watchers[key], cb)
+	h.watchersLock.Unlock()
+}
+
 func (h *Handler) Stop() error {
 	h.initialized = false
 	return nil
@@ -140,7 +192,7 @@ func (c *Handler) Get(ctx context.Context, id, ownerId, service, name string) (*
 
 	result, err := client.Get(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %s", cacheKey, err)
+		return nil, fmt.Errorf("%s: %w", cacheKey, err)
 	}
 
 	// Store the result in cache
@@ -210,6 +262,8 @@ func (c *Handler) Create(ctx context.Context, req *settingsservicepb.CreateReque
 	if err != nil {
 		return nil, err
 	}
+
+	defer c.flush()
 	return client.Create(ctx, req)
 }
 
@@ -219,6 +273,8 @@ func (c *Handler) Update(ctx context.Context, req *settingsservicepb.UpdateReque
 	if err != nil {
 		return nil, err
 	}
+
+	defer c.flush()
 	return client.Update(ctx, req)
 }
 
@@ -228,5 +284,64 @@ func (c *Handler) Upsert(ctx context.Context, req *settingsservicepb.UpsertReque
 	if err != nil {
 		return nil, err
 	}
+
+	defer c.flush()
 	return client.Upsert(ctx, req)
 }
+
+// IsNotFound reports whether Get failed because the setting doesn't exist.
+func IsNotFound(err error) bool {
+	// The client returns remote errors as JSON strings, Get wraps them
+	for ; err != nil; err = stderrors.Unwrap(err) {
+		if errors.FromError(err).Code == http.StatusNotFound {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsConflict reports whether Update failed because the content wasn't IfContent anymore.
+func IsConflict(err error) bool {
+	for ; err != nil; err = stderrors.Unwrap(err) {
+		if errors.FromError(err).Code == http.StatusConflict {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LoadJSON unmarshals the setting name of service over v, v holds the defaults.
+// When there is no such setting it stores v, readable and writeable by admins and services.
+// Other errors get returned, an outage must not overwrite what an admin configured.
+func (h *Handler) LoadJSON(ctx context.Context, service, name string, v interface{}) error {
+	se, err := h.Get(ctx, "", "", service, name)
+	if err == nil {
+		if err := json.Unmarshal(se.Content, v); err != nil {
+			return errors.FromError(err)
+		}
+
+		return nil
+	}
+	if !IsNotFound(err) {
+		return err
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return errors.FromError(err)
+	}
+
+	if _, err = h.Upsert(ctx, &settingsservicepb.UpsertRequest{
+		Service:     service,
+		Name:        name,
+		Content:     raw,
+		RolesRead:   []string{auth2.ROLE_ADMIN, auth2.ROLE_SERVICE},
+		RolesUpdate: []string{auth2.ROLE_ADMIN, auth2.ROLE_SERVICE},
+	}); err != nil {
+		return errors.FromError(err)
+	}
+
+	return nil
+}
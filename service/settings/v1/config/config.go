@@ -6,4 +6,7 @@ var (
 
 const (
 	Name = "microlobby.settings.v1"
+
+	// TopicChanged is the broker topic which gets a ChangedEvent for each created or updated setting
+	TopicChanged = "microlobby.settings.v1.changed"
 )
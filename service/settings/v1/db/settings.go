@@ -91,7 +91,11 @@ func SettingsCreate(cReg *components.Registry, ctx context.Context, in *settings
 	return &result, nil
 }
 
-func SettingsUpdate(cReg *components.Registry, ctx context.Context, id, ownerID, service, name string, content []byte) (*Setting, error) {
+// ErrConflict is returned by SettingsUpdate when the content isn't ifContent anymore
+var ErrConflict = errors.New("the setting changed meanwhile")
+
+// SettingsUpdate writes content, when ifContent is given only if the stored content is still ifContent.
+func SettingsUpdate(cReg *components.Registry, ctx context.Context, id, ownerID, service, name string, content, ifContent []byte) (*Setting, error) {
 	// Fetch current setting
 	s, err := SettingsGet(cReg, ctx, id, ownerID, service, name)
 	if err != nil {
@@ -106,16 +110,30 @@ func SettingsUpdate(cReg *components.Registry, ctx context.Context, id, ownerID,
 	s.UpdatedAt.Time = time.Now()
 
 	// Update
-	_, err = buncomponent.MustReg(cReg).Bun().NewUpdate().Model(s).Where("id = ?", s.ID).Exec(ctx)
+	q := buncomponent.MustReg(cReg).Bun().NewUpdate().Model(s).Where("id = ?", s.ID)
+	if len(ifContent) > 0 {
+		q = q.Where("content = ?", ifContent)
+	}
+	res, err := q.Exec(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	if len(ifContent) > 0 {
+		n, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if n < 1 {
+			return nil, ErrConflict
+		}
+	}
+
 	return s, nil
 }
 
 func SettingsUpsert(cReg *components.Registry, ctx context.Context, in *settingsservicepb.UpsertRequest) (*Setting, error) {
-	s, err := SettingsUpdate(cReg, ctx, "", in.OwnerId, in.Service, in.Name, in.Content)
+	s, err := SettingsUpdate(cReg, ctx, "", in.OwnerId, in.Service, in.Name, in.Content, nil)
 	if err == nil {
 		return s, nil
 	}
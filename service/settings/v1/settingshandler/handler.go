@@ -2,15 +2,19 @@ package settingshandler
 
 import (
 	"context"
+	"database/sql"
+	stderrors "errors"
 
 	"github.com/urfave/cli/v2"
-	"go-micro.dev/v4/util/log"
+	"go-micro.dev/v4"
+	"go-micro.dev/v4/errors"
 	"google.golang.org/protobuf/types/known/timestamppb"
 	"jochum.dev/jo-micro/auth2"
 	"jochum.dev/jo-micro/auth2/plugins/verifier/endpointroles"
 	"jochum.dev/jo-micro/components"
 	"jochum.dev/jo-micro/logruscomponent"
 	"jochum.dev/jo-micro/router"
+	"wz2100.net/microlobby/service/settings/v1/config"
 	"wz2100.net/microlobby/service/settings/v1/db"
 	"wz2100.net/microlobby/shared/proto/settingsservicepb/v1"
 )
@@ -133,6 +137,20 @@ func (h *Handler) translateDBSettingToPB(dbs *db.Setting, out *settingsservicepb
 	}
 }
 
+// publishChanged lets all settings clients know that they have to refetch a setting
+func (h *Handler) publishChanged(ctx context.Context, dbs *db.Setting) {
+	ev := &settingsservicepb.ChangedEvent{
+		Id:      dbs.ID.String(),
+		Service: dbs.Service,
+		OwnerId: dbs.OwnerID.String(),
+		Name:    dbs.Name,
+	}
+
+	if err := micro.NewEvent(config.TopicChanged, h.cReg.Service().Client()).Publish(ctx, ev); err != nil {
+		logruscomponent.MustReg(h.cReg).Logger().Error(err)
+	}
+}
+
 func (h *Handler) Create(ctx context.Context, in *settingsservicepb.CreateRequest, out *settingsservicepb.Setting) error {
 	result, err := db.SettingsCreate(h.cReg, ctx, in)
 	if err != nil {
@@ -140,16 +158,21 @@ func (h *Handler) Create(ctx context.Context, in *settingsservicepb.CreateReques
 	}
 
 	h.translateDBSettingToPB(result, out)
+	h.publishChanged(ctx, result)
 	return nil
 }
 
 func (h *Handler) Update(ctx context.Context, in *settingsservicepb.UpdateRequest, out *settingsservicepb.Setting) error {
-	result, err := db.SettingsUpdate(h.cReg, ctx, in.Id, "", "", "", in.Content)
-	if err != nil {
+	result, err := db.SettingsUpdate(h.cReg, ctx, in.Id, "", "", "", in.Content, in.IfContent)
+	if stderrors.Is(err, db.ErrConflict) {
+		// Clients read the setting again and retry
+		return errors.Conflict("CONFLICT", "The setting changed meanwhile")
+	} else if err != nil {
 		return err
 	}
 
 	h.translateDBSettingToPB(result, out)
+	h.publishChanged(ctx, result)
 	return nil
 }
 
@@ -160,13 +183,16 @@ func (h *Handler) Upsert(ctx context.Context, in *settingsservicepb.UpsertReques
 	}
 
 	h.translateDBSettingToPB(result, out)
-	log.Error(out.String())
+	h.publishChanged(ctx, result)
 	return nil
 }
 
 func (h *Handler) Get(ctx context.Context, in *settingsservicepb.GetRequest, out *settingsservicepb.Setting) error {
 	result, err := db.SettingsGet(h.cReg, ctx, in.Id, in.OwnerId, in.Service, in.Name)
-	if err != nil {
+	if err == sql.ErrNoRows {
+		// Clients store their defaults on NOT_FOUND only
+		return errors.NotFound("NOT_FOUND", "Setting not found")
+	} else if err != nil {
 		return err
 	}
 
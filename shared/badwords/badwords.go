@@ -0,0 +1,104 @@
+// Package badwords runs user supplied texts through the badwords service,
+// the policy which decides what happens with profane texts is stored in the settings service.
+package badwords
+
+import (
+	"context"
+	"fmt"
+
+	"jochum.dev/jo-micro/components"
+	"wz2100.net/microlobby/service/badwords/v1/config"
+	"wz2100.net/microlobby/service/settings"
+	"wz2100.net/microlobby/shared/proto/badwordspb/v1"
+	"wz2100.net/microlobby/shared/utils"
+)
+
+// Name of the policy setting, it belongs to the badwords service
+const Name = "policy"
+
+type Action string
+
+const (
+	// ActionOff doesn't check anything
+	ActionOff Action = "off"
+	// ActionCensor replaces profane words with stars
+	ActionCensor Action = "censor"
+	// ActionReject refuses profane texts
+	ActionReject Action = "reject"
+)
+
+type Policy struct {
+	Action Action `json:"action"`
+}
+
+// Field is a named text which Apply may censor in place
+type Field struct {
+	Name  string
+	Value *string
+}
+
+// ProfaneError is returned by Apply when the policy rejects a text
+type ProfaneError struct {
+	Field string
+}
+
+func (e *ProfaneError) Error() string {
+	return fmt.Sprintf("%s contains words which are not allowed", e.Field)
+}
+
+func DefaultPolicy() *Policy {
+	return &Policy{Action: ActionCensor}
+}
+
+// LoadPolicy fetches the Policy from the settings service, it stores the default if there is none.
+// ctx must be allowed to read service settings.
+func LoadPolicy(ctx context.Context, cReg *components.Registry) (*Policy, error) {
+	p := DefaultPolicy()
+	err := settings.MustReg(cReg).LoadJSON(ctx, config.Name, Name, p)
+	return p, err
+}
+
+func client(cReg *components.Registry) (badwordspb.BadwordsV1Service, error) {
+	// Wait until the service is here
+	_, err := utils.ServiceRetryGet(cReg.Service(), config.Name, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	return badwordspb.NewBadwordsV1Service(config.Name, cReg.Service().Client()), nil
+}
+
+// Apply checks all fields, it censors them or returns a ProfaneError depending on the Action.
+// ctx must be allowed to call the badwords service.
+func (p *Policy) Apply(ctx context.Context, cReg *components.Registry, fields ...Field) error {
+	if p.Action == ActionOff {
+		return nil
+	}
+
+	bw, err := client(cReg)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range fields {
+		if len(*f.Value) < 1 {
+			continue
+		}
+
+		result, err := bw.Check(ctx, &badwordspb.StringRequest{Request: *f.Value})
+		if err != nil {
+			return err
+		}
+		if !result.Profane {
+			continue
+		}
+
+		if p.Action == ActionReject {
+			return &ProfaneError{Field: f.Name}
+		}
+
+		*f.Value = result.Censored
+	}
+
+	return nil
+}
@@ -0,0 +1,329 @@
+// Package gamestruct encodes and decodes the legacy GAMESTRUCT which
+// Warzone 2100 clients send to and receive from the lobby v3 protocol.
+package gamestruct
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+)
+
+// Version is the GAMESTRUCT_VERSION the lobby sends, 3.x clients send it too.
+const Version = 3
+
+// Version4 is the GAMESTRUCT_VERSION of 4.x clients, it has the layout of Version.
+const Version4 = 4
+
+// Sizes of the fixed string fields including their NUL terminator.
+const (
+	NameSize          = 64
+	HostSize          = 40
+	ExtraSize         = 157
+	MapNameSize       = 40
+	HostNameSize      = 40
+	VersionStringSize = 64
+	ModListSize       = 255
+)
+
+// wireGame is the on-the-wire layout, encoding/binary writes it without padding.
+type wireGame struct {
+	Version        uint32
+	Name           [NameSize]byte
+	DwSize         int32
+	DwFlags        int32
+	Host           [HostSize]byte
+	MaxPlayers     int32
+	CurrentPlayers int32
+	DwUserFlags    [4]int32
+	Host2          [HostSize]byte
+	Host3          [HostSize]byte
+	Extra          [ExtraSize]byte
+	Port           uint16
+	MapName        [MapNameSize]byte
+	HostName       [HostNameSize]byte
+	VersionString  [VersionStringSize]byte
+	ModList        [ModListSize]byte
+	VersionMajor   uint32
+	VersionMinor   uint32
+	Private        uint32
+	Pure           uint32
+	Mods           uint32
+	GameId         uint32
+	Limits         uint32
+	Future3        uint32
+	Future4        uint32
+}
+
+// Size is the size of an encoded Game in bytes, every version so far has the same layout.
+// Versions after 3 only gave meaning to Limits and Future3/4.
+var Size = binary.Size(wireGame{})
+
+// FieldTooLongError is returned by MarshalBinary when a string doesn't fit into its field.
+type FieldTooLongError struct {
+	Field string
+	Size  int
+}
+
+func (e *FieldTooLongError) Error() string {
+	return fmt.Sprintf("gamestruct field %s is longer than %d bytes", e.Field, e.Size-1)
+}
+
+// Game is the decoded GAMESTRUCT.
+type Game struct {
+	Version        uint32
+	Name           string
+	DwSize         int32
+	DwFlags        int32
+	Host           string
+	MaxPlayers     int32
+	CurrentPlayers int32
+	DwUserFlags    [4]int32
+	Host2          string
+	Host3          string
+	Extra          string
+	Port           uint16
+	MapName        string
+	HostName       string
+	VersionString  string
+	ModList        string
+	VersionMajor   uint32
+	VersionMinor   uint32
+	Private        uint32
+	Pure           uint32
+	Mods           uint32
+	GameId         uint32
+	Limits         uint32
+	Future3        uint32
+	Future4        uint32
+}
+
+func putString(dst []byte, field, in string) error {
+	// Keep one byte for the NUL terminator
+	if len(in) > len(dst)-1 {
+		return &FieldTooLongError{Field: field, Size: len(dst)}
+	}
+
+	copy(dst, in)
+	return nil
+}
+
+func getString(in []byte) string {
+	if i := bytes.IndexByte(in, 0); i >= 0 {
+		in = in[:i]
+	}
+
+	return string(in)
+}
+
+// Truncate shortens in so it fits into a field of the given size, it never splits a rune.
+func Truncate(in string, size int) string {
+	if len(in) <= size-1 {
+		return in
+	}
+
+	in = in[:size-1]
+	for len(in) > 0 && !utf8.ValidString(in) {
+		in = in[:len(in)-1]
+	}
+
+	return in
+}
+
+// MarshalBinary encodes the Game in network byte order.
+func (g *Game) MarshalBinary() ([]byte, error) {
+	w := wireGame{
+		Version:        g.Version,
+		DwSize:         g.DwSize,
+		DwFlags:        g.DwFlags,
+		MaxPlayers:     g.MaxPlayers,
+		CurrentPlayers: g.CurrentPlayers,
+		DwUserFlags:    g.DwUserFlags,
+		Port:           g.Port,
+		VersionMajor:   g.VersionMajor,
+		VersionMinor:   g.VersionMinor,
+		Private:        g.Private,
+		Pure:           g.Pure,
+		Mods:           g.Mods,
+		GameId:         g.GameId,
+		Limits:         g.Limits,
+		Future3:        g.Future3,
+		Future4:        g.Future4,
+	}
+
+	strs := []struct {
+		field string
+		dst   []byte
+		in    string
+	}{
+		{"Name", w.Name[:], g.Name},
+		{"Host", w.Host[:], g.Host},
+		{"Host2", w.Host2[:], g.Host2},
+		{"Host3", w.Host3[:], g.Host3},
+		{"Extra", w.Extra[:], g.Extra},
+		{"MapName", w.MapName[:], g.MapName},
+		{"HostName", w.HostName[:], g.HostName},
+		{"VersionString", w.VersionString[:], g.VersionString},
+		{"ModList", w.ModList[:], g.ModList},
+	}
+	for _, s := range strs {
+		if err := putString(s.dst, s.field, s.in); err != nil {
+			return nil, err
+		}
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, Size))
+	if err := binary.Write(buf, binary.BigEndian, &w); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a Game of any version in network byte order.
+func (g *Game) UnmarshalBinary(data []byte) error {
+	if len(data) < Size {
+		return io.ErrUnexpectedEOF
+	}
+
+	var w wireGame
+	if err := binary.Read(bytes.NewReader(data), binary.BigEndian, &w); err != nil {
+		return err
+	}
+
+	*g = Game{
+		Version:        w.Version,
+		Name:           getString(w.Name[:]),
+		DwSize:         w.DwSize,
+		DwFlags:        w.DwFlags,
+		Host:           getString(w.Host[:]),
+		MaxPlayers:     w.MaxPlayers,
+		CurrentPlayers: w.CurrentPlayers,
+		DwUserFlags:    w.DwUserFlags,
+		Host2:          getString(w.Host2[:]),
+		Host3:          getString(w.Host3[:]),
+		Extra:          getString(w.Extra[:]),
+		Port:           w.Port,
+		MapName:        getString(w.MapName[:]),
+		HostName:       getString(w.HostName[:]),
+		VersionString:  getString(w.VersionString[:]),
+		ModList:        getString(w.ModList[:]),
+		VersionMajor:   w.VersionMajor,
+		VersionMinor:   w.VersionMinor,
+		Private:        w.Private,
+		Pure:           w.Pure,
+		Mods:           w.Mods,
+		GameId:         w.GameId,
+		Limits:         w.Limits,
+		Future3:        w.Future3,
+		Future4:        w.Future4,
+	}
+
+	return nil
+}
+
+// readRaw reads the bytes of one Game from r
+func readRaw(r io.Reader) ([]byte, error) {
+	data := make([]byte, Size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// Discard reads one Game from r without decoding it.
+func Discard(r io.Reader) error {
+	_, err := readRaw(r)
+	return err
+}
+
+// Read reads and decodes exactly one Game from r.
+func Read(r io.Reader) (*Game, error) {
+	data, err := readRaw(r)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Game{}
+	if err := g.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+func boolToUint32(in bool) uint32 {
+	if in {
+		return 1
+	}
+	return 0
+}
+
+// FromProto maps a gamedb game to a Game, strings get truncated to fit their fields.
+func FromProto(pg *gamedbpb.Game) *Game {
+	hostName := ""
+	for _, p := range pg.Players {
+		if p.IsHost {
+			hostName = p.Name
+			break
+		}
+	}
+
+	return &Game{
+		Version:        Version,
+		Name:           Truncate(pg.Description, NameSize),
+		Host:           Truncate(pg.HostIp, HostSize),
+		MaxPlayers:     int32(pg.MaxPlayers),
+		CurrentPlayers: int32(len(pg.Players)),
+		Port:           uint16(pg.Port),
+		MapName:        Truncate(pg.Map, MapNameSize),
+		HostName:       Truncate(hostName, HostNameSize),
+		VersionString:  Truncate(pg.Version, VersionStringSize),
+		ModList:        Truncate(strings.Join(pg.Mods, ", "), ModListSize),
+		VersionMajor:   pg.VerMajor,
+		VersionMinor:   pg.VerMinor,
+		Private:        boolToUint32(pg.IsPrivate),
+		Pure:           boolToUint32(pg.IsPure),
+		Mods:           uint32(len(pg.Mods)),
+		GameId:         pg.V3GameId,
+	}
+}
+
+// ToProto maps a Game to a lobby v3 gamedb game hosted by hostIp.
+func ToProto(g *Game, hostIp string) *gamedbpb.Game {
+	mods := []string{}
+	for _, m := range strings.Split(g.ModList, ",") {
+		m = strings.TrimSpace(m)
+		if len(m) > 0 {
+			mods = append(mods, m)
+		}
+	}
+
+	return &gamedbpb.Game{
+		Description: g.Name,
+		Map:         g.MapName,
+		Mods:        mods,
+		HostIp:      hostIp,
+		Port:        uint32(g.Port),
+		Players: []*gamedbpb.Player{
+			{
+				Name:      g.HostName,
+				IpAddress: hostIp,
+				IsHost:    true,
+			},
+		},
+		MaxPlayers:   uint32(g.MaxPlayers),
+		Version:      g.VersionString,
+		VerMajor:     g.VersionMajor,
+		VerMinor:     g.VersionMinor,
+		IsPure:       g.Pure != 0,
+		IsPrivate:    g.Private != 0,
+		V3GameId:     g.GameId,
+		LobbyVersion: 3,
+	}
+}
@@ -0,0 +1,183 @@
+package gamestruct
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// loadFrame builds a frame from a testdata file written by hand, it doesn't use the codec.
+// Each line is a decimal offset and the hex bytes there, everything after "#" is a comment.
+func loadFrame(t *testing.T, file string) []byte {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	data := make([]byte, Size)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			t.Fatalf("%s: bad line %q", file, scanner.Text())
+		}
+
+		offset, err := strconv.Atoi(fields[0])
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		b, err := hex.DecodeString(fields[1])
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		if offset+len(b) > Size {
+			t.Fatalf("%s: %q doesn't fit", file, scanner.Text())
+		}
+		copy(data[offset:], b)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+var frames = []struct {
+	file string
+	want Game
+}{
+	{
+		file: "v3.hex",
+		want: Game{
+			Version:        3,
+			Name:           "Rush 2v2",
+			MaxPlayers:     4,
+			CurrentPlayers: 1,
+			Port:           2100,
+			MapName:        "Sk-Rush",
+			HostName:       "Fastdeath",
+			VersionString:  "3.4.1",
+			VersionMajor:   3,
+			VersionMinor:   4,
+			Pure:           1,
+			GameId:         17,
+		},
+	},
+	{
+		file: "v4.hex",
+		want: Game{
+			Version:        4,
+			Name:           "NTW über alles",
+			MaxPlayers:     8,
+			CurrentPlayers: 3,
+			DwUserFlags:    [4]int32{2, 0, 0, 0},
+			Port:           2100,
+			MapName:        "NTW_4c",
+			HostName:       "höst",
+			VersionString:  "4.3.5",
+			ModList:        "ntw",
+			VersionMajor:   4,
+			VersionMinor:   3,
+			Private:        1,
+			Mods:           1,
+			GameId:         4711,
+			Limits:         0x11,
+		},
+	},
+}
+
+func TestFrames(t *testing.T) {
+	for _, tt := range frames {
+		t.Run(tt.file, func(t *testing.T) {
+			data := loadFrame(t, tt.file)
+
+			// The next game must stay in the stream
+			r := bytes.NewReader(append(append([]byte{}, data...), 0xff))
+			g, err := Read(r)
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if r.Len() != 1 {
+				t.Errorf("Read left %d bytes, want 1", r.Len())
+			}
+			if !reflect.DeepEqual(*g, tt.want) {
+				t.Errorf("Read:\n got %+v\nwant %+v", *g, tt.want)
+			}
+
+			out, err := g.MarshalBinary()
+			if err != nil {
+				t.Fatalf("MarshalBinary: %v", err)
+			}
+			if !bytes.Equal(out, data) {
+				t.Errorf("MarshalBinary doesn't give the frame back")
+			}
+		})
+	}
+}
+
+func TestNewerVersion(t *testing.T) {
+	// Newer clients kept the layout so far
+	data := loadFrame(t, "v4.hex")
+	data[3] = 7
+
+	g, err := Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if g.Version != 7 || g.GameId != 4711 || g.Limits != 0x11 {
+		t.Errorf("Read = %+v", *g)
+	}
+}
+
+func TestShortRead(t *testing.T) {
+	data := loadFrame(t, "v3.hex")
+
+	for _, n := range []int{0, 3, 4, Size - 1} {
+		if _, err := Read(bytes.NewReader(data[:n])); err == nil {
+			t.Errorf("Read of %d bytes didn't fail", n)
+		}
+	}
+}
+
+func TestMarshalTooLong(t *testing.T) {
+	g := &Game{Version: Version, MapName: string(make([]byte, MapNameSize))}
+
+	_, err := g.MarshalBinary()
+	var ferr *FieldTooLongError
+	if !errors.As(err, &ferr) || ferr.Field != "MapName" {
+		t.Errorf("MarshalBinary = %v, want a FieldTooLongError for MapName", err)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		in   string
+		size int
+		want string
+	}{
+		{"abc", 4, "abc"},
+		{"abcd", 4, "abc"},
+		{"aü", 3, "a"},
+		{"", 1, ""},
+	}
+
+	for _, tt := range tests {
+		if got := Truncate(tt.in, tt.size); got != tt.want {
+			t.Errorf("Truncate(%q, %d) = %q, want %q", tt.in, tt.size, got, tt.want)
+		}
+	}
+}
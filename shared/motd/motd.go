@@ -0,0 +1,142 @@
+// Package motd selects the message of the day which the lobbies send to clients,
+// it's stored as a JSON document in the settings service.
+package motd
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"jochum.dev/jo-micro/components"
+	"wz2100.net/microlobby/service/settings"
+)
+
+// Service and Name locate the MOTD in the settings service
+const (
+	Service = "microlobby.motd"
+	Name    = "motd"
+)
+
+const (
+	DefaultText            = "Welcome to the Warzone 2100 lobby"
+	DefaultMaintenanceText = "The lobby is in maintenance, please try again later"
+)
+
+// Message is a MOTD variant, empty Versions or Locales match every client.
+type Message struct {
+	Text string `json:"text"`
+
+	// Versions are prefixes of the clients version string, "4.3" matches "4.3.5"
+	Versions []string `json:"versions"`
+	// Locales like "de" or "de_DE", "de" matches "de_AT" too
+	Locales []string `json:"locales"`
+
+	// Optional schedule window
+	Start *time.Time `json:"start,omitempty"`
+	End   *time.Time `json:"end,omitempty"`
+}
+
+type Config struct {
+	// Default is sent when no Message matches
+	Default string `json:"default"`
+
+	// Maintenance replaces all messages with MaintenanceText, lobbies don't accept new games
+	Maintenance     bool   `json:"maintenance"`
+	MaintenanceText string `json:"maintenance_text"`
+
+	Messages []Message `json:"messages"`
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Default:         DefaultText,
+		MaintenanceText: DefaultMaintenanceText,
+		Messages:        []Message{},
+	}
+}
+
+// Load fetches the MOTD from the settings service, it stores the defaults if there is none.
+// ctx must be allowed to read service settings.
+func Load(ctx context.Context, cReg *components.Registry) (*Config, error) {
+	c := DefaultConfig()
+	err := settings.MustReg(cReg).LoadJSON(ctx, Service, Name, c)
+	return c, err
+}
+
+func (m *Message) active(now time.Time) bool {
+	if m.Start != nil && now.Before(*m.Start) {
+		return false
+	}
+	if m.End != nil && !now.Before(*m.End) {
+		return false
+	}
+
+	return true
+}
+
+// score returns how specific m matches version and locale, -1 if it doesn't match at all.
+func (m *Message) score(version, locale string) int {
+	score := 0
+
+	if len(m.Versions) > 0 {
+		found := false
+		for _, v := range m.Versions {
+			if len(version) > 0 && strings.HasPrefix(version, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return -1
+		}
+		score += 4
+	}
+
+	if len(m.Locales) > 0 {
+		best := -1
+		locale = strings.ToLower(strings.ReplaceAll(locale, "-", "_"))
+		for _, l := range m.Locales {
+			l = strings.ToLower(strings.ReplaceAll(l, "-", "_"))
+			if len(locale) < 1 {
+				break
+			}
+
+			if l == locale {
+				best = 2
+				break
+			}
+			if strings.HasPrefix(locale, l+"_") && best < 1 {
+				best = 1
+			}
+		}
+		if best < 0 {
+			return -1
+		}
+		score += best
+	}
+
+	return score
+}
+
+// Text returns the message for a client, version and locale may be empty.
+func (c *Config) Text(version, locale string, now time.Time) string {
+	if c.Maintenance {
+		return c.MaintenanceText
+	}
+
+	text := c.Default
+	best := -1
+	for i := range c.Messages {
+		m := &c.Messages[i]
+		if !m.active(now) {
+			continue
+		}
+
+		if s := m.score(version, locale); s > best {
+			best = s
+			text = m.Text
+		}
+	}
+
+	return text
+}
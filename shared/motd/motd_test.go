@@ -0,0 +1,91 @@
+package motd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       Message
+		version string
+		locale  string
+		want    int
+	}{
+		{"everyone", Message{}, "4.3.5", "de_DE", 0},
+		{"version", Message{Versions: []string{"4.3"}}, "4.3.5", "", 4},
+		{"other version", Message{Versions: []string{"4.2"}}, "4.3.5", "", -1},
+		{"no version", Message{Versions: []string{"4.3"}}, "", "", -1},
+		{"locale", Message{Locales: []string{"de_DE"}}, "", "de_DE", 2},
+		{"locale with dash", Message{Locales: []string{"de-de"}}, "", "DE_de", 2},
+		{"language", Message{Locales: []string{"de"}}, "", "de_AT", 1},
+		{"language only", Message{Locales: []string{"de"}}, "", "de", 2},
+		{"other language", Message{Locales: []string{"de"}}, "", "fr_FR", -1},
+		{"no prefix match", Message{Locales: []string{"d"}}, "", "de_DE", -1},
+		{"no locale", Message{Locales: []string{"de"}}, "", "", -1},
+		{"both", Message{Versions: []string{"4"}, Locales: []string{"de", "de_AT"}}, "4.3.5", "de_AT", 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.m.score(tt.version, tt.locale); got != tt.want {
+				t.Errorf("score = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestText(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	c := DefaultConfig()
+	c.Messages = []Message{
+		{Text: "all"},
+		{Text: "german", Locales: []string{"de"}},
+		{Text: "4.3", Versions: []string{"4.3"}},
+		{Text: "over", Versions: []string{"4.2"}, End: &past},
+		{Text: "soon", Versions: []string{"4.1"}, Start: &future},
+		{Text: "ends now", Versions: []string{"4.0"}, End: &now},
+	}
+
+	tests := []struct {
+		name    string
+		version string
+		locale  string
+		want    string
+	}{
+		{"unspecific", "", "", "all"},
+		{"locale", "", "de_DE", "german"},
+		{"version wins", "4.3.5", "de_DE", "4.3"},
+		{"expired", "4.2.0", "", "all"},
+		{"scheduled", "4.1.0", "", "all"},
+		{"end is exclusive", "4.0.0", "", "all"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.Text(tt.version, tt.locale, now); got != tt.want {
+				t.Errorf("Text = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// The first of equal matches wins
+	c.Messages = append([]Message{{Text: "first"}}, c.Messages...)
+	if got := c.Text("", "", now); got != "first" {
+		t.Errorf("Text = %q, want first", got)
+	}
+
+	c.Messages = nil
+	if got := c.Text("4.3.5", "de", now); got != DefaultText {
+		t.Errorf("Text without messages = %q, want the default", got)
+	}
+
+	c.Maintenance = true
+	if got := c.Text("4.3.5", "de", now); got != DefaultMaintenanceText {
+		t.Errorf("Text in maintenance = %q, want the maintenance text", got)
+	}
+}
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+)
+
+// sharedAddressSpace is the carrier grade NAT range, net doesn't count it as private
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// IsPublicIP reports whether ip is a global unicast address outside the private ranges,
+// probe only those for addresses users give, anything else lets them scan our own networks.
+func IsPublicIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+// ProbeHost checks if a host accepts TCP connections on the given port, works for IPv4 and IPv6.
+func ProbeHost(ctx context.Context, host string, port uint32, timeout time.Duration) error {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.FormatUint(uint64(port), 10)))
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
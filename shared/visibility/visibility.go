@@ -0,0 +1,75 @@
+// Package visibility decides what a caller gets to know about a game, gamedb and the
+// gateway apply the same rules to their responses, events and streams.
+package visibility
+
+import (
+	"jochum.dev/jo-micro/auth2"
+	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+)
+
+// Viewer is who looks at a game, each sees more than the one before
+type Viewer int
+
+const (
+	Anonymous Viewer = iota
+	User
+	Player
+	Host
+	Admin
+)
+
+// ViewerOf tells what user is for the game, user is nil for anonymous callers
+func ViewerOf(user *auth2.User, pg *gamedbpb.Game) Viewer {
+	if user == nil || len(user.Id) < 1 {
+		return Anonymous
+	}
+
+	if auth2.IntersectsRoles(user, auth2.RolesServiceAndAdmin...) {
+		return Admin
+	}
+
+	result := User
+	for _, p := range pg.Players {
+		if p.Uuid != user.Id {
+			continue
+		}
+
+		if p.IsHost && p.IpAddress == pg.HostIp {
+			return Host
+		}
+		result = Player
+	}
+
+	return result
+}
+
+// CanSee reports whether the viewer may know about the game at all, private games are for their players
+func (v Viewer) CanSee(pg *gamedbpb.Game) bool {
+	return !pg.IsPrivate || v >= Player
+}
+
+// Redact removes what the viewer may not see from pg, userId is the id of the viewer
+func (v Viewer) Redact(userId string, pg *gamedbpb.Game) {
+	if v >= Host {
+		return
+	}
+
+	// Internals of the lobbies
+	pg.V3GameId = 0
+	pg.LobbyVersion = 0
+
+	// Players get the hosts IP to connect, nobody gets the IP's of the other players
+	if v < Player {
+		pg.HostIp = ""
+	}
+	for _, p := range pg.Players {
+		if v == Player && p.Uuid == userId {
+			continue
+		}
+		p.IpAddress = ""
+
+		if v == Anonymous {
+			p.Uuid = ""
+		}
+	}
+}
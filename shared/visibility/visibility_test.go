@@ -0,0 +1,111 @@
+package visibility
+
+import (
+	"testing"
+
+	"jochum.dev/jo-micro/auth2"
+	"wz2100.net/microlobby/shared/proto/gamedbpb/v1"
+)
+
+const (
+	hostId   = "00000000-0000-0000-0000-000000000001"
+	playerId = "00000000-0000-0000-0000-000000000002"
+	otherId  = "00000000-0000-0000-0000-000000000003"
+)
+
+func testGame(private bool) *gamedbpb.Game {
+	return &gamedbpb.Game{
+		HostIp:       "198.51.100.1",
+		IsPrivate:    private,
+		V3GameId:     42,
+		LobbyVersion: 3,
+		Players: []*gamedbpb.Player{
+			{Uuid: hostId, IsHost: true, IpAddress: "198.51.100.1"},
+			{Uuid: playerId, IpAddress: "198.51.100.2"},
+		},
+	}
+}
+
+func TestViewerOf(t *testing.T) {
+	tests := []struct {
+		name string
+		user *auth2.User
+		want Viewer
+	}{
+		{"anonymous", nil, Anonymous},
+		{"no id", &auth2.User{}, Anonymous},
+		{"user", &auth2.User{Id: otherId}, User},
+		{"player", &auth2.User{Id: playerId}, Player},
+		{"host", &auth2.User{Id: hostId}, Host},
+		{"admin", &auth2.User{Id: otherId, Roles: []string{auth2.ROLE_ADMIN}}, Admin},
+		{"service", &auth2.User{Id: "lobby", Roles: []string{auth2.ROLE_SERVICE}}, Admin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ViewerOf(tt.user, testGame(false)); got != tt.want {
+				t.Errorf("viewerOf = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// A host player with another IP than the game is no host
+	pg := testGame(false)
+	pg.HostIp = "198.51.100.9"
+	if got := ViewerOf(&auth2.User{Id: hostId}, pg); got != Player {
+		t.Errorf("viewerOf with another host IP = %v, want %v", got, Player)
+	}
+}
+
+func TestCanSee(t *testing.T) {
+	for _, v := range []Viewer{Anonymous, User, Player, Host, Admin} {
+		if !v.CanSee(testGame(false)) {
+			t.Errorf("viewer %v can't see a public game", v)
+		}
+
+		want := v >= Player
+		if got := v.CanSee(testGame(true)); got != want {
+			t.Errorf("viewer %v canSee private = %v, want %v", v, got, want)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name      string
+		v         Viewer
+		userId    string
+		hostIp    string
+		playerIps []string
+		uuids     bool
+		internals bool
+	}{
+		{"anonymous", Anonymous, "", "", []string{"", ""}, false, false},
+		{"user", User, otherId, "", []string{"", ""}, true, false},
+		{"player", Player, playerId, "198.51.100.1", []string{"", "198.51.100.2"}, true, false},
+		{"host", Host, hostId, "198.51.100.1", []string{"198.51.100.1", "198.51.100.2"}, true, true},
+		{"admin", Admin, otherId, "198.51.100.1", []string{"198.51.100.1", "198.51.100.2"}, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pg := testGame(false)
+			tt.v.Redact(tt.userId, pg)
+
+			if pg.HostIp != tt.hostIp {
+				t.Errorf("HostIp = %q, want %q", pg.HostIp, tt.hostIp)
+			}
+			for i, p := range pg.Players {
+				if p.IpAddress != tt.playerIps[i] {
+					t.Errorf("player %d IpAddress = %q, want %q", i, p.IpAddress, tt.playerIps[i])
+				}
+				if (p.Uuid != "") != tt.uuids {
+					t.Errorf("player %d Uuid = %q", i, p.Uuid)
+				}
+			}
+			if (pg.V3GameId != 0) != tt.internals || (pg.LobbyVersion != 0) != tt.internals {
+				t.Errorf("V3GameId = %d, LobbyVersion = %d", pg.V3GameId, pg.LobbyVersion)
+			}
+		})
+	}
+}